@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"time"
@@ -9,46 +10,175 @@ import (
 )
 
 type Config struct {
-	Env    string `yaml:"env" env-default:"local"`
-	DB     `yaml:"db"`
-	Server `yaml:"httpServer"`
+	Env     string `yaml:"env" env-default:"local"`
+	DB      `yaml:"db"`
+	Server  `yaml:"httpServer"`
+	Auth    `yaml:"auth"`
+	Jobs    `yaml:"jobs"`
+	Trash   `yaml:"trash"`
+	Cache   `yaml:"cache"`
+	Stats   `yaml:"stats"`
+	Metrics `yaml:"metrics"`
+	Tracing `yaml:"tracing"`
 }
 
 type Server struct {
 	Host string `yaml:"host" env-defult:"0.0.0.0"`
 	Port string `yaml:"port" env-default:"8082"`
 
-	Timeout time.Duration `yaml:"timeout" env-default:"4s"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"4s"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" env-default:"15s"`
+
+	MaxLimit int64 `yaml:"maxLimit" env:"MAX_LIMIT" env-default:"100"`
+	MaxBatch int   `yaml:"maxBatch" env:"MAX_BATCH" env-default:"50"`
 }
 
+// DB is the role of the service, row level security applies to it only when
+// it is neither a superuser nor BYPASSRLS. Migrations run as MigrateUser, the
+// owner of the tables, and create the service role.
 type DB struct {
-	User     string `yaml:"user" env:"PG_USER" env-default:"postgres"`
+	User     string `yaml:"user" env:"PG_USER" env-default:"banner_app"`
 	Password string `yaml:"password" env:"PG_PASSWORD" env-required:"true"`
 	Host     string `yaml:"host" env:"PG_HOST" env-default:"localhost"`
 	Port     int    `yaml:"port" env:"PG_PORT" env-default:"5432"`
 	DBName   string `yaml:"dbname" env:"PG_DBNAME" env-required:"true"`
+
+	MigrateUser     string `yaml:"migrateUser" env:"PG_MIGRATE_USER" env-default:"postgres"`
+	MigratePassword string `yaml:"migratePassword" env:"PG_MIGRATE_PASSWORD"`
+
+	VersionLimit int           `yaml:"versionLimit" env:"PG_VERSION_LIMIT" env-default:"3"`
+	QueryTimeout time.Duration `yaml:"queryTimeout" env:"PG_QUERY_TIMEOUT" env-default:"2s"`
+}
+
+type Auth struct {
+	Secret    string        `yaml:"secret" env:"AUTH_SECRET"`
+	PublicKey string        `yaml:"publicKey" env:"AUTH_PUBLIC_KEY"`
+	Issuer    string        `yaml:"issuer" env:"AUTH_ISSUER"`
+	Audience  string        `yaml:"audience" env:"AUTH_AUDIENCE"`
+	Leeway    time.Duration `yaml:"leeway" env:"AUTH_LEEWAY" env-default:"30s"`
+}
+
+// Jobs.Lease is how long a claimed job stays with its replica without a
+// batch, after that another replica resumes it. It must be well above
+// PollInterval, the longest pause between batches.
+type Jobs struct {
+	BatchSize    int           `yaml:"batchSize" env:"JOBS_BATCH_SIZE" env-default:"100"`
+	Pause        time.Duration `yaml:"pause" env:"JOBS_PAUSE" env-default:"100ms"`
+	PollInterval time.Duration `yaml:"pollInterval" env:"JOBS_POLL_INTERVAL" env-default:"5s"`
+	Lease        time.Duration `yaml:"lease" env:"JOBS_LEASE" env-default:"1m"`
+}
+
+// Trash keeps deleted banners for Retention before the purger removes them.
+type Trash struct {
+	Retention time.Duration `yaml:"retention" env:"TRASH_RETENTION" env-default:"720h"`
+	Interval  time.Duration `yaml:"interval" env:"TRASH_INTERVAL" env-default:"1h"`
+	BatchSize int           `yaml:"batchSize" env:"TRASH_BATCH_SIZE" env-default:"100"`
+}
+
+// Stats.MaxPending bounds the counters kept in memory while the database is
+// unavailable, counters of new keys beyond it are dropped.
+type Stats struct {
+	BatchSize     int           `yaml:"batchSize" env:"STATS_BATCH_SIZE" env-default:"1000"`
+	FlushInterval time.Duration `yaml:"flushInterval" env:"STATS_FLUSH_INTERVAL" env-default:"5s"`
+	MaxPending    int           `yaml:"maxPending" env:"STATS_MAX_PENDING" env-default:"100000"`
+}
+
+type Metrics struct {
+	Path      string `yaml:"path" env:"METRICS_PATH" env-default:"/metrics"`
+	Namespace string `yaml:"namespace" env:"METRICS_NAMESPACE" env-default:"banner"`
+}
+
+type Tracing struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT" env-default:"localhost:4318"`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE" env-default:"true"`
+	ServiceName string  `yaml:"serviceName" env:"TRACING_SERVICE_NAME" env-default:"banner"`
+	SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+}
+
+type Cache struct {
+	Backend   string        `yaml:"backend" env:"CACHE_BACKEND" env-default:"memory"`
+	TTL       time.Duration `yaml:"ttl" env:"CACHE_TTL" env-default:"5m"`
+	KeyFormat string        `yaml:"keyFormat" env:"CACHE_KEY_FORMAT" env-default:"banner:%d:%d"`
+	Codec     string        `yaml:"codec" env:"CACHE_CODEC" env-default:"json"`
+	Redis     Redis         `yaml:"redis"`
+
+	// MaxEntries bounds the memory backend, the least recently used entries
+	// are dropped first.
+	MaxEntries int `yaml:"maxEntries" env:"CACHE_MAX_ENTRIES" env-default:"10000"`
+
+	// StaleTTL keeps expired entries that long, they are served while one
+	// request refreshes them. Zero disables stale-while-revalidate.
+	StaleTTL time.Duration `yaml:"staleTTL" env:"CACHE_STALE_TTL" env-default:"0s"`
+	// NegativeTTL keeps "no banner" results of user requests, zero disables it.
+	NegativeTTL time.Duration `yaml:"negativeTTL" env:"CACHE_NEGATIVE_TTL" env-default:"30s"`
+
+	Warmup Warmup `yaml:"warmup"`
+}
+
+// Warmup loads the banners of Tenants into the cache before the service
+// reports ready, and again every RefreshInterval (zero disables it).
+// Limit keeps only the banners with most impressions during Window, zero
+// loads all active banners.
+type Warmup struct {
+	Enabled         bool          `yaml:"enabled" env:"CACHE_WARMUP_ENABLED" env-default:"false"`
+	Tenants         []string      `yaml:"tenants" env:"CACHE_WARMUP_TENANTS" env-default:"default"`
+	Limit           int           `yaml:"limit" env:"CACHE_WARMUP_LIMIT" env-default:"0"`
+	Window          time.Duration `yaml:"window" env:"CACHE_WARMUP_WINDOW" env-default:"168h"`
+	Timeout         time.Duration `yaml:"timeout" env:"CACHE_WARMUP_TIMEOUT" env-default:"1m"`
+	RefreshInterval time.Duration `yaml:"refreshInterval" env:"CACHE_WARMUP_REFRESH_INTERVAL" env-default:"0s"`
+}
+
+type Redis struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" env-default:"localhost:6379"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB" env-default:"0"`
 }
 
 func MustLoad() *Config {
+	var cfg Config
+
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
 		log.Println("local.yml not set")
-		var cfg Config
 		if err := cleanenv.ReadEnv(&cfg); err != nil {
 			log.Fatalf("cannot read env: %s", err)
 		}
-		return &cfg
-	}
+	} else {
+		if _, err := os.Stat(configPath); os.IsNotExist(err) {
+			log.Fatalf("config file %s does not exist", configPath)
+		}
 
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		log.Fatalf("config file %s does not exist", configPath)
+		if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
+			log.Fatalf("cannot read config: %s", err)
+		}
 	}
 
-	var cfg Config
-
-	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		log.Fatalf("cannot read config: %s", err)
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("invalid config: %s", err)
 	}
 
 	return &cfg
 }
+
+// Validate reports the settings the service cannot run with, cleanenv checks
+// only that they are present.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.MaxBatch <= 0 {
+		errs = append(errs, errors.New("httpServer.maxBatch must be positive"))
+	}
+	if c.Jobs.BatchSize <= 0 {
+		errs = append(errs, errors.New("jobs.batchSize must be positive"))
+	}
+	if c.Trash.BatchSize <= 0 {
+		errs = append(errs, errors.New("trash.batchSize must be positive"))
+	}
+	if c.Stats.BatchSize <= 0 {
+		errs = append(errs, errors.New("stats.batchSize must be positive"))
+	}
+	if c.Stats.MaxPending < c.Stats.BatchSize {
+		errs = append(errs, errors.New("stats.maxPending must not be below stats.batchSize"))
+	}
+	return errors.Join(errs...)
+}
@@ -7,25 +7,112 @@ import (
 )
 
 type BannerDB struct {
-	ID      *int64                  `json:"id"`
-	Tag     []*int64                `json:"tag_ids"`
-	Feature *int64                  `json:"feature_id"`
-	Content *map[string]interface{} `json:"content"`
-	Access  *bool                   `json:"is_active"`
-	Created *time.Time              `json:"created_at"`
-	Updated *time.Time              `json:"updated_at"`
+	ID          *int64                  `json:"id"`
+	Tag         []*int64                `json:"tag_ids"`
+	Feature     *int64                  `json:"feature_id"`
+	Content     *map[string]interface{} `json:"content"`
+	Access      *bool                   `json:"is_active"`
+	ActiveFrom  *time.Time              `json:"active_from"`
+	ActiveUntil *time.Time              `json:"active_until"`
+	Created     *time.Time              `json:"created_at"`
+	Updated     *time.Time              `json:"updated_at"`
+	Deleted     *time.Time              `json:"deleted_at,omitempty"`
 }
 
 type BannerPost struct {
-	Tag     []int64                `json:"tag_ids" validate:"required,dive,gt=0"`
-	Feature int64                  `json:"feature_id" validate:"required,gt=0"`
-	Content map[string]interface{} `json:"content" validate:"required"`
-	Access  bool                   `json:"is_active" validate:"required"`
+	Tag         []int64                `json:"tag_ids" validate:"required,dive,gt=0"`
+	Feature     int64                  `json:"feature_id" validate:"required,gt=0"`
+	Content     map[string]interface{} `json:"content" validate:"required"`
+	Access      bool                   `json:"is_active" validate:"required"`
+	ActiveFrom  *time.Time             `json:"active_from"`
+	ActiveUntil *time.Time             `json:"active_until"`
+
+	// CreateMissing inserts the feature and tags that do not exist yet.
+	CreateMissing bool `json:"-"`
+}
+
+// BannerConflict is a feature and tag pair owned by another banner.
+type BannerConflict struct {
+	BannerID  int64 `json:"banner_id"`
+	FeatureID int64 `json:"feature_id"`
+	TagID     int64 `json:"tag_id"`
 }
 
 type BannerPatch struct {
-	Tag     optional.Optional[[]int64]                `json:"tag_ids"`
-	Feature optional.Optional[int64]                  `json:"feature_id"`
-	Content optional.Optional[map[string]interface{}] `json:"content"`
-	Access  optional.Optional[bool]                   `json:"is_active"`
+	Tag         optional.Optional[[]int64]                `json:"tag_ids"`
+	Feature     optional.Optional[int64]                  `json:"feature_id"`
+	Content     optional.Optional[map[string]interface{}] `json:"content"`
+	Access      optional.Optional[bool]                   `json:"is_active"`
+	ActiveFrom  optional.Optional[time.Time]              `json:"active_from"`
+	ActiveUntil optional.Optional[time.Time]              `json:"active_until"`
+}
+
+type BannerFilter struct {
+	Tag      int64
+	Feature  int64
+	Limit    int64
+	Offset   int64
+	AfterID  int64
+	ActiveAt *time.Time
+}
+
+type BannerVersion struct {
+	Version     int64                   `json:"version"`
+	Tag         []*int64                `json:"tag_ids"`
+	Feature     *int64                  `json:"feature_id"`
+	Content     *map[string]interface{} `json:"content"`
+	Access      *bool                   `json:"is_active"`
+	ActiveFrom  *time.Time              `json:"active_from"`
+	ActiveUntil *time.Time              `json:"active_until"`
+	Updated     *time.Time              `json:"updated_at"`
+}
+
+// Violation is a place in the banner content that does not match the schema
+// of its feature.
+type Violation struct {
+	Variant *int64 `json:"variant_id,omitempty"`
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// BannerKey is one slot of POST /user_banner/batch.
+type BannerKey struct {
+	Tag     int `json:"tag_id"`
+	Feature int `json:"feature_id"`
+}
+
+// KeyedBanner is a banner together with one of the keys users reach it by.
+type KeyedBanner struct {
+	Key    BannerKey
+	Banner *UserBanner
+}
+
+type UserBanner struct {
+	ID          int64
+	Content     map[string]interface{}
+	Variants    []Variant
+	Access      *bool
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+}
+
+// Visible reports whether the banner can be shown at the moment now.
+// Admins see inactive and out of schedule banners as well.
+func (b *UserBanner) Visible(admin bool, now time.Time) bool {
+	if b.Access == nil {
+		return false
+	}
+	if admin {
+		return true
+	}
+	if !*b.Access {
+		return false
+	}
+	if b.ActiveFrom != nil && now.Before(*b.ActiveFrom) {
+		return false
+	}
+	if b.ActiveUntil != nil && !now.Before(*b.ActiveUntil) {
+		return false
+	}
+	return true
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// CacheStats is the answer of GET /admin/cache. Hits and misses are the
+// tenant's requests served by this instance since its start, the keys belong
+// to the tenant.
+type CacheStats struct {
+	Size     int          `json:"size"`
+	Hits     uint64       `json:"hits"`
+	Misses   uint64       `json:"misses"`
+	HitRatio float64      `json:"hit_ratio"`
+	Keys     []CacheEntry `json:"keys"`
+}
+
+// CacheEntry describes one cached {tag, feature} key. BannerID is nil for a
+// cached "not found".
+type CacheEntry struct {
+	Tag        int                    `json:"tag_id"`
+	Feature    int                    `json:"feature_id"`
+	BannerID   *int64                 `json:"banner_id"`
+	AgeSeconds float64                `json:"age_seconds"`
+	StoredAt   time.Time              `json:"stored_at"`
+	FreshUntil time.Time              `json:"fresh_until"`
+	ExpiresAt  time.Time              `json:"expires_at"`
+	Stale      bool                   `json:"stale"`
+	Content    map[string]interface{} `json:"content,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+type Job struct {
+	ID      int64      `json:"id"`
+	Tenant  string     `json:"-"`
+	Feature *int64     `json:"feature_id"`
+	Tag     *int64     `json:"tag_id"`
+	Status  string     `json:"status"`
+	Total   int64      `json:"total"`
+	Deleted int64      `json:"deleted"`
+	Error   *string    `json:"error,omitempty"`
+	Created *time.Time `json:"created_at"`
+	Updated *time.Time `json:"updated_at"`
+
+	// Claim identifies the claim of the replica working on the job.
+	Claim int64 `json:"-"`
+}
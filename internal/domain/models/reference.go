@@ -0,0 +1,27 @@
+package models
+
+import "github.com/AnxVit/avito/internal/domain/models/optional"
+
+// ReferenceKind names the table of the ids banners refer to.
+type ReferenceKind string
+
+const (
+	KindFeature ReferenceKind = "feature"
+	KindTag     ReferenceKind = "tag"
+)
+
+type Reference struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ReferencePost struct {
+	Name        string `json:"name" validate:"required,max=255"`
+	Description string `json:"description" validate:"max=1024"`
+}
+
+type ReferencePatch struct {
+	Name        optional.Optional[string] `json:"name"`
+	Description optional.Optional[string] `json:"description"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// StatsDelta is an increment of the counters of one banner for one day.
+type StatsDelta struct {
+	Tenant      string
+	BannerID    int64
+	Day         time.Time
+	Impressions int64
+	Clicks      int64
+}
+
+type BannerStats struct {
+	Day         string  `json:"day"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+type Click struct {
+	BannerID int64 `json:"banner_id" validate:"required,gt=0"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models/optional"
+)
+
+type Variant struct {
+	ID      int64                  `json:"id"`
+	Weight  int64                  `json:"weight"`
+	Content map[string]interface{} `json:"content"`
+	Created *time.Time             `json:"created_at,omitempty"`
+	Updated *time.Time             `json:"updated_at,omitempty"`
+}
+
+type VariantPost struct {
+	Content map[string]interface{} `json:"content" validate:"required"`
+	Weight  int64                  `json:"weight" validate:"required,gt=0"`
+}
+
+type VariantPatch struct {
+	Content optional.Optional[map[string]interface{}] `json:"content"`
+	Weight  optional.Optional[int64]                  `json:"weight"`
+}
+
+// Pick chooses the content shown to the user. A banner without variants
+// serves its own content and variant 0, otherwise the variant is picked by
+// weight using a hash of the user and banner ids, so a user always gets the same one.
+func (b *UserBanner) Pick(user string) (map[string]interface{}, int64) {
+	var total uint64
+	for _, v := range b.Variants {
+		total += uint64(v.Weight)
+	}
+	if total == 0 {
+		return b.Content, 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(user + ":" + strconv.FormatInt(b.ID, 10)))
+	point := h.Sum64() % total
+
+	for _, v := range b.Variants {
+		if point < uint64(v.Weight) {
+			return v.Content, v.ID
+		}
+		point -= uint64(v.Weight)
+	}
+	return b.Content, 0
+}
@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type Cache interface {
+	Inspect(ctx context.Context, limit int) (*models.CacheStats, error)
+	InspectKey(ctx context.Context, tag, feature int) (*models.CacheEntry, error)
+	Purge(ctx context.Context, tag, feature *int) (int, error)
+}
+
+type purged struct {
+	Purged int    `json:"purged"`
+	Error  string `json:"error,omitempty"`
+}
+
+func NewGetCache(adminLog *slog.Logger, inspector Cache, maxLimit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(adminLog, w, r) {
+			return
+		}
+
+		limit := int(maxLimit)
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				adminLog.Info("limit is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("limit is incorrect"))
+				return
+			}
+			if maxLimit <= 0 || int64(n) < maxLimit {
+				limit = n
+			}
+		}
+
+		stats, err := inspector.Inspect(r.Context(), limit)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				adminLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			adminLog.Error("falied to inspect cache", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, stats)
+	}
+}
+
+func NewGetCacheKey(adminLog *slog.Logger, inspector Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(adminLog, w, r) {
+			return
+		}
+
+		var tag, feature int
+		for name, dst := range map[string]*int{"tag": &tag, "feature": &feature} {
+			n, err := strconv.Atoi(chi.URLParam(r, name))
+			if err != nil || n <= 0 {
+				adminLog.Info("not correct " + name)
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("not correct "+name))
+				return
+			}
+			*dst = n
+		}
+
+		entry, err := inspector.InspectKey(r.Context(), tag, feature)
+		if err != nil {
+			if errors.Is(err, cache.ErrNotCached) {
+				adminLog.Info("key not cached")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				adminLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			adminLog.Error("falied to inspect cache key", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, entry)
+	}
+}
+
+// NewPurgeCache drops the cached keys of the tenant, only those of tag_id
+// and feature_id when they are given. A purge that reached only this
+// instance still answers 200 with the count and an error.
+func NewPurgeCache(adminLog *slog.Logger, purger Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(adminLog, w, r) {
+			return
+		}
+
+		var tag, feature *int
+		for name, dst := range map[string]**int{"tag_id": &tag, "feature_id": &feature} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				adminLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			*dst = &n
+		}
+
+		n, err := purger.Purge(r.Context(), tag, feature)
+		if errors.Is(err, cache.ErrNotBroadcast) {
+			adminLog.Error("failed to notify other instances", slog.String("error", err.Error()))
+			render.JSON(w, r, purged{Purged: n, Error: "other instances are not purged"})
+			return
+		}
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				adminLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			adminLog.Error("falied to purge cache", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		adminLog.Info("cache purged", slog.Int("keys", n))
+		render.JSON(w, r, purged{Purged: n})
+	}
+}
+
+func admin(adminLog *slog.Logger, w http.ResponseWriter, r *http.Request) bool {
+	permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+	if permission == access.User {
+		adminLog.Info("don't have permission")
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if permission == access.NotAccess {
+		adminLog.Info("unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -1,15 +1,18 @@
 package banner
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/AnxVit/avito/internal/domain/models"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	"github.com/AnxVit/avito/internal/lib/api/cursor"
 	resp "github.com/AnxVit/avito/internal/lib/api/response"
 	"github.com/AnxVit/avito/internal/storage"
 	"github.com/go-chi/chi/v5"
@@ -18,15 +21,31 @@ import (
 )
 
 type Repository interface {
-	GetBanner(tag, feature, limit, offset string) ([]models.BannerDB, error)
-	PostBanner(banner *models.BannerPost) (int64, error)
-	PatchBanner(id string, banner *models.BannerPatch) error
-	DeleteBanner(id string) error
+	GetBanner(ctx context.Context, filter *models.BannerFilter) ([]models.BannerDB, error)
+	PostBanner(ctx context.Context, banner *models.BannerPost) (int64, error)
+	PatchBanner(ctx context.Context, id int64, banner *models.BannerPatch) error
+	DeleteBanner(ctx context.Context, id int64) error
+	GetVersions(ctx context.Context, id int64) ([]models.BannerVersion, error)
+	RestoreVersion(ctx context.Context, id, version int64) error
+	GetTrash(ctx context.Context, limit, offset int64) ([]models.BannerDB, error)
+	RestoreBanner(ctx context.Context, id int64) error
+	GetStats(ctx context.Context, id int64, from, to *time.Time) ([]models.BannerStats, error)
 }
 
-func NewGet(bannerLog *slog.Logger, getter Repository) http.HandlerFunc {
+type Jobs interface {
+	EnqueueDelete(ctx context.Context, feature, tag *int64) (int64, error)
+}
+
+type Page struct {
+	Banners    []models.BannerDB `json:"banners"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// NewGet serves both pagination modes: offset requests get a bare array as before,
+// requests carrying the cursor parameter (empty for the first page) get a Page.
+func NewGet(bannerLog *slog.Logger, getter Repository, maxLimit int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		permission := r.Context().Value(auth.UserContextKey).(access.Access) //nolint:forcetypeassert
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
 		if permission == access.User {
 			bannerLog.Info("don't have permission")
 			w.WriteHeader(http.StatusForbidden)
@@ -38,18 +57,72 @@ func NewGet(bannerLog *slog.Logger, getter Repository) http.HandlerFunc {
 			return
 		}
 
-		tag := r.URL.Query().Get("tag_id")
-		feature := r.URL.Query().Get("feature_id")
-		limit := r.URL.Query().Get("limit")
-		offset := r.URL.Query().Get("offset")
+		var filter models.BannerFilter
+		for name, dst := range map[string]*int64{
+			"tag_id":     &filter.Tag,
+			"feature_id": &filter.Feature,
+			"limit":      &filter.Limit,
+			"offset":     &filter.Offset,
+		} {
+			n, ok := queryInt(r, name)
+			if !ok {
+				bannerLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			*dst = n
+		}
 
-		banner, err := getter.GetBanner(tag, feature, limit, offset)
+		if at := r.URL.Query().Get("active_at"); at != "" {
+			t, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				bannerLog.Info("active_at is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("active_at is incorrect"))
+				return
+			}
+			filter.ActiveAt = &t
+		}
+
+		paginate := r.URL.Query().Has("cursor")
+		if paginate {
+			if c := r.URL.Query().Get("cursor"); c != "" {
+				afterID, err := cursor.Decode(c)
+				if err != nil {
+					bannerLog.Info("cursor is incorrect")
+					w.WriteHeader(http.StatusBadRequest)
+					render.JSON(w, r, resp.Error("cursor is incorrect"))
+					return
+				}
+				filter.AfterID = afterID
+			}
+			if filter.Offset != 0 {
+				bannerLog.Info("cursor with offset")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("cursor and offset are mutually exclusive"))
+				return
+			}
+			if filter.Limit == 0 {
+				filter.Limit = maxLimit
+			}
+		}
+		if maxLimit > 0 && filter.Limit > maxLimit {
+			filter.Limit = maxLimit
+		}
+
+		banner, err := getter.GetBanner(r.Context(), &filter)
 		if err != nil {
 			if errors.Is(err, storage.ErrNotAccess) {
 				bannerLog.Info("not access")
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
 			bannerLog.Error("falied to get banner", slog.Attr{
 				Key:   "error",
 				Value: slog.StringValue(err.Error()),
@@ -57,13 +130,25 @@ func NewGet(bannerLog *slog.Logger, getter Repository) http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		render.JSON(w, r, banner)
+		if !paginate {
+			render.JSON(w, r, banner)
+			return
+		}
+
+		page := Page{Banners: banner}
+		if page.Banners == nil {
+			page.Banners = []models.BannerDB{}
+		}
+		if len(banner) > 0 && int64(len(banner)) == filter.Limit {
+			page.NextCursor = cursor.Encode(*banner[len(banner)-1].ID)
+		}
+		render.JSON(w, r, page)
 	}
 }
 
 func NewPost(bannerLog *slog.Logger, setter Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		permission := r.Context().Value(auth.UserContextKey).(access.Access) //nolint:forcetypeassert
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
 		if permission == access.User {
 			bannerLog.Info("don't have permission")
 			w.WriteHeader(http.StatusForbidden)
@@ -103,8 +188,42 @@ func NewPost(bannerLog *slog.Logger, setter Repository) http.HandlerFunc {
 			render.JSON(w, r, resp.Error("invalid body"))
 			return
 		}
-		id, err := setter.PostBanner(&banner)
+		if banner.ActiveFrom != nil && banner.ActiveUntil != nil && !banner.ActiveFrom.Before(*banner.ActiveUntil) {
+			bannerLog.Info("unsupported value: active_from/active_until")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("active_until must be after active_from"))
+			return
+		}
+		if r.URL.Query().Get("create_missing") == "true" {
+			banner.CreateMissing = true
+		}
+		id, err := setter.PostBanner(r.Context(), &banner)
 		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				bannerLog.Info("unknown feature or tag")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				render.JSON(w, r, resp.Error("unknown feature or tag"))
+				return
+			}
+			var conflict *storage.ConflictError
+			if errors.As(err, &conflict) {
+				bannerLog.Info("banner conflict", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Conflict(storage.ErrBannerConflict.Error(), conflict.Conflicts))
+				return
+			}
+			var invalid *storage.ContentError
+			if errors.As(err, &invalid) {
+				bannerLog.Info("invalid content", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Invalid(storage.ErrInvalidContent.Error(), invalid.Violations))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
 			bannerLog.Error("failed to post banner", slog.Attr{
 				Key:   "error",
 				Value: slog.StringValue(err.Error()),
@@ -119,7 +238,7 @@ func NewPost(bannerLog *slog.Logger, setter Repository) http.HandlerFunc {
 
 func NewPatch(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		permission := r.Context().Value(auth.UserContextKey).(access.Access) //nolint:forcetypeassert
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
 		if permission == access.User {
 			bannerLog.Info("don't have permission")
 			w.WriteHeader(http.StatusForbidden)
@@ -131,8 +250,8 @@ func NewPatch(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
 			return
 		}
 
-		id := chi.URLParam(r, "id")
-		if _, err := strconv.Atoi(id); err != nil {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			bannerLog.Info("not correct id")
 			render.JSON(w, r, resp.Error("not correct id"))
@@ -140,7 +259,7 @@ func NewPatch(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
 		}
 		banner := models.BannerPatch{}
 
-		err := json.NewDecoder(r.Body).Decode(&banner)
+		err = json.NewDecoder(r.Body).Decode(&banner)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 			if _, ok := err.(*json.SyntaxError); ok {
@@ -170,13 +289,51 @@ func NewPatch(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
 				return
 			}
 		}
-		err = changer.PatchBanner(id, &banner)
+		if banner.ActiveFrom.Value != nil && banner.ActiveUntil.Value != nil &&
+			!banner.ActiveFrom.Value.Before(*banner.ActiveUntil.Value) {
+			bannerLog.Info("unsupported value: active_from/active_until")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("active_until must be after active_from"))
+			return
+		}
+		err = changer.PatchBanner(r.Context(), id, &banner)
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
 				bannerLog.Info("banner not found")
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
+			if errors.Is(err, storage.ErrInvalidSchedule) {
+				bannerLog.Info("unsupported value: active_from/active_until")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(storage.ErrInvalidSchedule.Error()))
+				return
+			}
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				bannerLog.Info("unknown feature or tag")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				render.JSON(w, r, resp.Error("unknown feature or tag"))
+				return
+			}
+			var conflict *storage.ConflictError
+			if errors.As(err, &conflict) {
+				bannerLog.Info("banner conflict", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Conflict(storage.ErrBannerConflict.Error(), conflict.Conflicts))
+				return
+			}
+			var invalid *storage.ContentError
+			if errors.As(err, &invalid) {
+				bannerLog.Info("invalid content", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Invalid(storage.ErrInvalidContent.Error(), invalid.Violations))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
 			bannerLog.Error("falied to patch banner", slog.Attr{
 				Key:   "error",
 				Value: slog.StringValue(err.Error()),
@@ -190,7 +347,7 @@ func NewPatch(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
 
 func NewDelete(bannerLog *slog.Logger, deleter Repository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		permission := r.Context().Value(auth.UserContextKey).(access.Access) //nolint:forcetypeassert
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
 		if permission == access.User {
 			bannerLog.Info("don't have permission")
 			w.WriteHeader(http.StatusForbidden)
@@ -202,21 +359,26 @@ func NewDelete(bannerLog *slog.Logger, deleter Repository) http.HandlerFunc {
 			return
 		}
 
-		id := chi.URLParam(r, "id")
-		if _, err := strconv.Atoi(id); err != nil {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
 			w.WriteHeader(http.StatusBadRequest)
 			bannerLog.Info("not correct id")
 			render.JSON(w, r, resp.Error("not correct id"))
 			return
 		}
 
-		err := deleter.DeleteBanner(id)
+		err = deleter.DeleteBanner(r.Context(), id)
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
 				bannerLog.Info("banner not found")
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
 			bannerLog.Error("falied to delete banner", slog.Attr{
 				Key:   "error",
 				Value: slog.StringValue(err.Error()),
@@ -229,3 +391,260 @@ func NewDelete(bannerLog *slog.Logger, deleter Repository) http.HandlerFunc {
 		render.JSON(w, r, resp.OK())
 	}
 }
+
+func NewGetVersions(bannerLog *slog.Logger, getter Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			bannerLog.Info("not correct id")
+			render.JSON(w, r, resp.Error("not correct id"))
+			return
+		}
+
+		versions, err := getter.GetVersions(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				bannerLog.Info("banner not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to get banner versions", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, versions)
+	}
+}
+
+func NewGetStats(bannerLog *slog.Logger, getter Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			bannerLog.Info("not correct id")
+			render.JSON(w, r, resp.Error("not correct id"))
+			return
+		}
+
+		var from, to *time.Time
+		for name, bound := range map[string]**time.Time{"from": &from, "to": &to} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			day, err := time.Parse(time.DateOnly, value)
+			if err != nil {
+				bannerLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			*bound = &day
+		}
+		if from != nil && to != nil && from.After(*to) {
+			bannerLog.Info("from is after to")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("from is after to"))
+			return
+		}
+
+		stats, err := getter.GetStats(r.Context(), id, from, to)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				bannerLog.Info("banner not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to get banner stats", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, stats)
+	}
+}
+
+func NewRestoreVersion(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			bannerLog.Info("not correct id")
+			render.JSON(w, r, resp.Error("not correct id"))
+			return
+		}
+		version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 64)
+		if err != nil || version <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			bannerLog.Info("not correct version")
+			render.JSON(w, r, resp.Error("not correct version"))
+			return
+		}
+
+		err = changer.RestoreVersion(r.Context(), id, version)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) || errors.Is(err, storage.ErrVersionNotFound) {
+				bannerLog.Info("banner version not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				bannerLog.Info("unknown feature or tag")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				render.JSON(w, r, resp.Error("unknown feature or tag"))
+				return
+			}
+			if errors.Is(err, storage.ErrInvalidSchedule) {
+				bannerLog.Info("unsupported value: active_from/active_until")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(storage.ErrInvalidSchedule.Error()))
+				return
+			}
+			var conflict *storage.ConflictError
+			if errors.As(err, &conflict) {
+				bannerLog.Info("banner conflict", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Conflict(storage.ErrBannerConflict.Error(), conflict.Conflicts))
+				return
+			}
+			var invalid *storage.ContentError
+			if errors.As(err, &invalid) {
+				bannerLog.Info("invalid content", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Invalid(storage.ErrInvalidContent.Error(), invalid.Violations))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to restore banner version", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+func NewBulkDelete(bannerLog *slog.Logger, jobs Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var feature, tag *int64
+		for name, dst := range map[string]**int64{"feature_id": &feature, "tag_id": &tag} {
+			id, ok := queryInt(r, name)
+			if !ok || (id == 0 && r.URL.Query().Get(name) != "") {
+				bannerLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			if id != 0 {
+				*dst = &id
+			}
+		}
+		if feature == nil && tag == nil {
+			bannerLog.Info("required tag/feature")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("not set tag and/or feature"))
+			return
+		}
+
+		id, err := jobs.EnqueueDelete(r.Context(), feature, tag)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("failed to enqueue delete job", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		render.JSON(w, r, resp.Job(id))
+	}
+}
+
+// queryInt parses an optional non-negative integer query parameter,
+// a missing parameter is returned as 0.
+func queryInt(r *http.Request, name string) (int64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,117 @@
+package banner
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+func NewGetTrash(bannerLog *slog.Logger, getter Repository, maxLimit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var limit, offset int64
+		for name, dst := range map[string]*int64{
+			"limit":  &limit,
+			"offset": &offset,
+		} {
+			n, ok := queryInt(r, name)
+			if !ok {
+				bannerLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			*dst = n
+		}
+		if maxLimit > 0 && (limit == 0 || limit > maxLimit) {
+			limit = maxLimit
+		}
+
+		banners, err := getter.GetTrash(r.Context(), limit, offset)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to get trash", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, banners)
+	}
+}
+
+func NewRestore(bannerLog *slog.Logger, changer Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			bannerLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			bannerLog.Info("not correct id")
+			render.JSON(w, r, resp.Error("not correct id"))
+			return
+		}
+
+		err = changer.RestoreBanner(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				bannerLog.Info("banner not in trash")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var conflict *storage.ConflictError
+			if errors.As(err, &conflict) {
+				bannerLog.Info("banner conflict", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Conflict(storage.ErrBannerConflict.Error(), conflict.Conflicts))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to restore banner", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
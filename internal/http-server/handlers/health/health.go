@@ -0,0 +1,36 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+
+	"github.com/go-chi/render"
+)
+
+type Checker interface {
+	Ready(ctx context.Context) error
+}
+
+func NewLive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+// NewReady reports ready when all checkers do.
+func NewReady(healthLog *slog.Logger, checkers ...Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, checker := range checkers {
+			if err := checker.Ready(r.Context()); err != nil {
+				healthLog.Warn("not ready", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusServiceUnavailable)
+				render.JSON(w, r, resp.Error("not ready"))
+				return
+			}
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
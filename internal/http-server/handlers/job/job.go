@@ -0,0 +1,67 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type Jobs interface {
+	GetJob(ctx context.Context, id int64) (*models.Job, error)
+}
+
+func NewGet(jobLog *slog.Logger, jobs Jobs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.User {
+			jobLog.Info("don't have permission")
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if permission == access.NotAccess {
+			jobLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil || id <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			jobLog.Info("not correct id")
+			render.JSON(w, r, resp.Error("not correct id"))
+			return
+		}
+
+		job, err := jobs.GetJob(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, storage.ErrJobNotFound) {
+				jobLog.Info("job not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				jobLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			jobLog.Error("falied to get job", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, job)
+	}
+}
@@ -0,0 +1,264 @@
+package reference
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Repository interface {
+	GetReferences(ctx context.Context, kind models.ReferenceKind, limit, offset int64) ([]models.Reference, error)
+	GetReference(ctx context.Context, kind models.ReferenceKind, id int64) (*models.Reference, error)
+	PostReference(ctx context.Context, kind models.ReferenceKind, reference *models.ReferencePost) (int64, error)
+	PatchReference(ctx context.Context, kind models.ReferenceKind, id int64, reference *models.ReferencePatch) error
+	DeleteReference(ctx context.Context, kind models.ReferenceKind, id int64) error
+}
+
+func NewList(referenceLog *slog.Logger, getter Repository, kind models.ReferenceKind, maxLimit int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		var limit, offset int64
+		for name, dst := range map[string]*int64{
+			"limit":  &limit,
+			"offset": &offset,
+		} {
+			value := r.URL.Query().Get(name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				referenceLog.Info(name + " is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error(name+" is incorrect"))
+				return
+			}
+			*dst = n
+		}
+		if maxLimit > 0 && (limit == 0 || limit > maxLimit) {
+			limit = maxLimit
+		}
+
+		references, err := getter.GetReferences(r.Context(), kind, limit, offset)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to get "+string(kind), slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, references)
+	}
+}
+
+func NewGet(referenceLog *slog.Logger, getter Repository, kind models.ReferenceKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		reference, err := getter.GetReference(r.Context(), kind, id)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info(string(kind) + " not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to get "+string(kind), slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, reference)
+	}
+}
+
+func NewPost(referenceLog *slog.Logger, setter Repository, kind models.ReferenceKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		var reference models.ReferencePost
+		err := json.NewDecoder(r.Body).Decode(&reference)
+		if err != nil {
+			referenceLog.Info("NewPost", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if err = validator.New().Struct(reference); err != nil {
+			referenceLog.Info("NewPost", slog.String("failed to validate", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+
+		id, err := setter.PostReference(r.Context(), kind, &reference)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("failed to post "+string(kind), slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, resp.Reference(id))
+	}
+}
+
+func NewPatch(referenceLog *slog.Logger, changer Repository, kind models.ReferenceKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		var reference models.ReferencePatch
+		err := json.NewDecoder(r.Body).Decode(&reference)
+		if err != nil {
+			referenceLog.Info("NewPatch", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if (reference.Name.Defined && (reference.Name.Value == nil || *reference.Name.Value == "" || len(*reference.Name.Value) > 255)) ||
+			(reference.Description.Defined && (reference.Description.Value == nil || len(*reference.Description.Value) > 1024)) {
+			referenceLog.Info("unsupported value: name/description")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("unsupported type of value"))
+			return
+		}
+
+		err = changer.PatchReference(r.Context(), kind, id, &reference)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info(string(kind) + " not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to patch "+string(kind), slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+func NewDelete(referenceLog *slog.Logger, deleter Repository, kind models.ReferenceKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		err := deleter.DeleteReference(r.Context(), kind, id)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info(string(kind) + " not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if errors.Is(err, storage.ErrReferenceInUse) {
+				referenceLog.Info(string(kind) + " is in use")
+				w.WriteHeader(http.StatusConflict)
+				render.JSON(w, r, resp.Error(string(kind)+" is used by banners"))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to delete "+string(kind), slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func admin(referenceLog *slog.Logger, w http.ResponseWriter, r *http.Request) bool {
+	permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+	if permission == access.User {
+		referenceLog.Info("don't have permission")
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if permission == access.NotAccess {
+		referenceLog.Info("unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func urlID(referenceLog *slog.Logger, w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		referenceLog.Info("not correct id")
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("not correct id"))
+		return 0, false
+	}
+	return id, true
+}
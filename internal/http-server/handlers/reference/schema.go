@@ -0,0 +1,146 @@
+package reference
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/lib/schema"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/go-chi/render"
+)
+
+// maxSchemaSize limits the body of PUT /feature/{id}/schema.
+const maxSchemaSize = 64 << 10
+
+type SchemaRepository interface {
+	GetFeatureSchema(ctx context.Context, id int64) (json.RawMessage, error)
+	SetFeatureSchema(ctx context.Context, id int64, contentSchema json.RawMessage) error
+}
+
+func NewGetSchema(referenceLog *slog.Logger, getter SchemaRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		contentSchema, err := getter.GetFeatureSchema(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info("feature not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to get feature schema", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if contentSchema == nil {
+			referenceLog.Info("feature schema not set")
+			w.WriteHeader(http.StatusNotFound)
+			render.JSON(w, r, resp.Error("schema is not set"))
+			return
+		}
+		render.JSON(w, r, contentSchema)
+	}
+}
+
+func NewPutSchema(referenceLog *slog.Logger, setter SchemaRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSchemaSize+1))
+		if err != nil || len(body) > maxSchemaSize || !json.Valid(body) {
+			referenceLog.Info("NewPutSchema", slog.String("failed to read", "invalid body"))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if _, err = schema.Compile(body); err != nil {
+			referenceLog.Info("NewPutSchema", slog.String("failed to compile", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error(err.Error()))
+			return
+		}
+
+		err = setter.SetFeatureSchema(r.Context(), id, body)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info("feature not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to set feature schema", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+func NewDeleteSchema(referenceLog *slog.Logger, setter SchemaRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(referenceLog, w, r) {
+			return
+		}
+
+		id, ok := urlID(referenceLog, w, r)
+		if !ok {
+			return
+		}
+
+		err := setter.SetFeatureSchema(r.Context(), id, nil)
+		if err != nil {
+			if errors.Is(err, storage.ErrReferenceNotFound) {
+				referenceLog.Info("feature not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				referenceLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			referenceLog.Error("falied to delete feature schema", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,136 @@
+package userbanner
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+
+	"github.com/go-chi/render"
+)
+
+const (
+	StatusFound    = "found"
+	StatusNotFound = "not_found"
+	StatusInactive = "inactive"
+)
+
+// DefaultMaxBatch is used when NewBatch gets no positive limit.
+const DefaultMaxBatch = 50
+
+type BatchBanner interface {
+	GetUserBanners(ctx context.Context, keys [][2]int, useLastVersion bool) (map[[2]int]*models.UserBanner, error)
+}
+
+// BatchItem is the result of one slot, the response maps "tag_id:feature_id"
+// to it.
+type BatchItem struct {
+	Status    string                 `json:"status"`
+	BannerID  int64                  `json:"banner_id,omitempty"`
+	VariantID int64                  `json:"variant_id,omitempty"`
+	Content   map[string]interface{} `json:"content,omitempty"`
+}
+
+func NewBatch(bannerLog *slog.Logger, banner BatchBanner, tracker Tracker, maxBatch int) http.HandlerFunc {
+	if maxBatch < 1 {
+		maxBatch = DefaultMaxBatch
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := r.Context().Value(auth.UserContextKey).(access.Principal) //nolint:forcetypeassert
+		permission := principal.Access
+
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var items []models.BannerKey
+		err := json.NewDecoder(r.Body).Decode(&items)
+		if err != nil {
+			bannerLog.Info("NewBatch", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if len(items) == 0 || len(items) > maxBatch {
+			bannerLog.Info("unsupported batch size", slog.Int("size", len(items)))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("batch must contain from 1 to "+strconv.Itoa(maxBatch)+" items"))
+			return
+		}
+
+		keys := make([][2]int, 0, len(items))
+		seen := make(map[[2]int]bool, len(items))
+		for _, item := range items {
+			if item.Tag <= 0 || item.Feature <= 0 {
+				bannerLog.Info("unsupported value: tag/feature")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("not set tag and/or feature"))
+				return
+			}
+			key := [2]int{item.Tag, item.Feature}
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+
+		var lastVers bool
+		if last := r.URL.Query().Get("use_last_revision"); last != "" {
+			lastVers, err = strconv.ParseBool(last)
+			if err != nil {
+				bannerLog.Info("use_last_version is incorrect")
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Error("use_last_version is incorrect"))
+				return
+			}
+		}
+
+		banners, err := banner.GetUserBanners(r.Context(), keys, lastVers)
+		if err != nil {
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			bannerLog.Error("falied to get banners", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		admin := permission == access.Admin
+		now := time.Now()
+		result := make(map[string]BatchItem, len(keys))
+		for _, key := range keys {
+			name := strconv.Itoa(key[0]) + ":" + strconv.Itoa(key[1])
+			banner, ok := banners[key]
+			switch {
+			case !ok:
+				result[name] = BatchItem{Status: StatusNotFound}
+			case !banner.Visible(admin, now):
+				result[name] = BatchItem{Status: StatusInactive}
+			default:
+				content, variant := banner.Pick(principal.Subject)
+				tracker.Impression(r.Context(), banner.ID)
+				result[name] = BatchItem{
+					Status:    StatusFound,
+					BannerID:  banner.ID,
+					VariantID: variant,
+					Content:   content,
+				}
+			}
+		}
+		render.JSON(w, r, result)
+	}
+}
@@ -1,17 +1,21 @@
 package userbanner
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
 
+	"github.com/AnxVit/avito/internal/domain/models"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
 	resp "github.com/AnxVit/avito/internal/lib/api/response"
 	"github.com/AnxVit/avito/internal/storage"
 
 	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
 )
 
 type Response struct {
@@ -19,12 +23,18 @@ type Response struct {
 }
 
 type Banner interface {
-	GetUserBanner(tag, feature int, useLastVersion bool, admin bool) (map[string]interface{}, error)
+	GetUserBanner(ctx context.Context, tag, feature int, useLastVersion bool, admin bool) (*models.UserBanner, error)
 }
 
-func New(bannerLog *slog.Logger, banner Banner) http.HandlerFunc {
+type Tracker interface {
+	Impression(ctx context.Context, bannerID int64)
+	Click(ctx context.Context, bannerID int64)
+}
+
+func New(bannerLog *slog.Logger, banner Banner, tracker Tracker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		permission := r.Context().Value(auth.UserContextKey).(access.Access) //nolint:forcetypeassert
+		principal := r.Context().Value(auth.UserContextKey).(access.Principal) //nolint:forcetypeassert
+		permission := principal.Access
 
 		if permission == access.NotAccess {
 			bannerLog.Info("unauthorized")
@@ -77,7 +87,7 @@ func New(bannerLog *slog.Logger, banner Banner) http.HandlerFunc {
 			admin = true
 		}
 
-		banner, err := banner.GetUserBanner(tagID, featureID, lastVers, admin)
+		banner, err := banner.GetUserBanner(r.Context(), tagID, featureID, lastVers, admin)
 		if err != nil {
 			if errors.Is(err, storage.ErrBannerNotFound) {
 				bannerLog.Info("banner not found")
@@ -89,6 +99,11 @@ func New(bannerLog *slog.Logger, banner Banner) http.HandlerFunc {
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
+			if status := resp.ContextStatus(err); status != 0 {
+				bannerLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
 			bannerLog.Error("falied to get banner", slog.Attr{
 				Key:   "error",
 				Value: slog.StringValue(err.Error()),
@@ -96,6 +111,41 @@ func New(bannerLog *slog.Logger, banner Banner) http.HandlerFunc {
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
-		render.JSON(w, r, banner)
+		content, variant := banner.Pick(principal.Subject)
+		w.Header().Set("X-Banner-Id", strconv.FormatInt(banner.ID, 10))
+		if variant != 0 {
+			w.Header().Set("X-Banner-Variant-Id", strconv.FormatInt(variant, 10))
+		}
+		tracker.Impression(r.Context(), banner.ID)
+		render.JSON(w, r, content)
+	}
+}
+
+func NewClick(bannerLog *slog.Logger, tracker Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+		if permission == access.NotAccess {
+			bannerLog.Info("unauthorized")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var click models.Click
+		err := json.NewDecoder(r.Body).Decode(&click)
+		if err != nil {
+			bannerLog.Info("NewClick", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if err = validator.New().Struct(click); err != nil {
+			bannerLog.Info("NewClick", slog.String("failed to validate", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+
+		tracker.Click(r.Context(), click.BannerID)
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,243 @@
+package variant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/go-playground/validator/v10"
+)
+
+type Repository interface {
+	GetVariants(ctx context.Context, bannerID int64) ([]models.Variant, error)
+	PostVariant(ctx context.Context, bannerID int64, variant *models.VariantPost) (int64, error)
+	PatchVariant(ctx context.Context, bannerID, variantID int64, variant *models.VariantPatch) error
+	DeleteVariant(ctx context.Context, bannerID, variantID int64) error
+}
+
+func NewGet(variantLog *slog.Logger, getter Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(variantLog, w, r) {
+			return
+		}
+
+		bannerID, ok := urlID(variantLog, w, r, "id")
+		if !ok {
+			return
+		}
+
+		variants, err := getter.GetVariants(r.Context(), bannerID)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				variantLog.Info("banner not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				variantLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			variantLog.Error("falied to get variants", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, variants)
+	}
+}
+
+func NewPost(variantLog *slog.Logger, setter Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(variantLog, w, r) {
+			return
+		}
+
+		bannerID, ok := urlID(variantLog, w, r, "id")
+		if !ok {
+			return
+		}
+
+		var variant models.VariantPost
+		err := json.NewDecoder(r.Body).Decode(&variant)
+		if err != nil {
+			variantLog.Info("NewPost", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if err = validator.New().Struct(variant); err != nil {
+			variantLog.Info("NewPost", slog.String("failed to validate", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+
+		id, err := setter.PostVariant(r.Context(), bannerID, &variant)
+		if err != nil {
+			if errors.Is(err, storage.ErrBannerNotFound) {
+				variantLog.Info("banner not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var invalid *storage.ContentError
+			if errors.As(err, &invalid) {
+				variantLog.Info("invalid content", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Invalid(storage.ErrInvalidContent.Error(), invalid.Violations))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				variantLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			variantLog.Error("failed to post variant", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, resp.Variant(id))
+	}
+}
+
+func NewPatch(variantLog *slog.Logger, changer Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(variantLog, w, r) {
+			return
+		}
+
+		bannerID, ok := urlID(variantLog, w, r, "id")
+		if !ok {
+			return
+		}
+		variantID, ok := urlID(variantLog, w, r, "variant")
+		if !ok {
+			return
+		}
+
+		var variant models.VariantPatch
+		err := json.NewDecoder(r.Body).Decode(&variant)
+		if err != nil {
+			variantLog.Info("NewPatch", slog.String("failed to unmarshall", err.Error()))
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("invalid body"))
+			return
+		}
+		if (variant.Content.Defined && variant.Content.Value == nil) ||
+			(variant.Weight.Defined && (variant.Weight.Value == nil || *variant.Weight.Value <= 0)) {
+			variantLog.Info("unsupported value: content/weight")
+			w.WriteHeader(http.StatusBadRequest)
+			render.JSON(w, r, resp.Error("unsupported type of value"))
+			return
+		}
+
+		err = changer.PatchVariant(r.Context(), bannerID, variantID, &variant)
+		if err != nil {
+			if errors.Is(err, storage.ErrVariantNotFound) {
+				variantLog.Info("variant not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var invalid *storage.ContentError
+			if errors.As(err, &invalid) {
+				variantLog.Info("invalid content", slog.String("error", err.Error()))
+				w.WriteHeader(http.StatusBadRequest)
+				render.JSON(w, r, resp.Invalid(storage.ErrInvalidContent.Error(), invalid.Violations))
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				variantLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			variantLog.Error("falied to patch variant", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, resp.OK())
+	}
+}
+
+func NewDelete(variantLog *slog.Logger, deleter Repository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !admin(variantLog, w, r) {
+			return
+		}
+
+		bannerID, ok := urlID(variantLog, w, r, "id")
+		if !ok {
+			return
+		}
+		variantID, ok := urlID(variantLog, w, r, "variant")
+		if !ok {
+			return
+		}
+
+		err := deleter.DeleteVariant(r.Context(), bannerID, variantID)
+		if err != nil {
+			if errors.Is(err, storage.ErrVariantNotFound) {
+				variantLog.Info("variant not found")
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if status := resp.ContextStatus(err); status != 0 {
+				variantLog.Info("request canceled", slog.String("error", err.Error()))
+				w.WriteHeader(status)
+				return
+			}
+			variantLog.Error("falied to delete variant", slog.Attr{
+				Key:   "error",
+				Value: slog.StringValue(err.Error()),
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func admin(variantLog *slog.Logger, w http.ResponseWriter, r *http.Request) bool {
+	permission := r.Context().Value(auth.UserContextKey).(access.Principal).Access //nolint:forcetypeassert
+	if permission == access.User {
+		variantLog.Info("don't have permission")
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	if permission == access.NotAccess {
+		variantLog.Info("unauthorized")
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func urlID(variantLog *slog.Logger, w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil || id <= 0 {
+		variantLog.Info("not correct " + name)
+		w.WriteHeader(http.StatusBadRequest)
+		render.JSON(w, r, resp.Error("not correct "+name))
+		return 0, false
+	}
+	return id, true
+}
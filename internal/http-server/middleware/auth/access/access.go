@@ -8,11 +8,22 @@ const (
 	NotAccess
 )
 
-func GetAccess(token string) Access {
-	if token == "user_token" {
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type Principal struct {
+	Subject string
+	Tenant  string
+	Access  Access
+}
+
+func GetAccess(role string) Access {
+	if role == RoleUser {
 		return User
 	}
-	if token == "admin_token" {
+	if role == RoleAdmin {
 		return Admin
 	}
 	return NotAccess
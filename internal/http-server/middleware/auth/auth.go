@@ -2,9 +2,18 @@ package auth
 
 import (
 	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strings"
 
+	"github.com/AnxVit/avito/internal/config"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type tokenKey uint
@@ -13,17 +22,109 @@ const (
 	UserContextKey tokenKey = 1
 )
 
-func MiddlewareAuth(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("token")
+var (
+	ErrNoKey         = errors.New("neither secret nor public key is configured")
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
 
-		var acc access.Access
-		if token == "" {
-			acc = access.NotAccess
-		} else {
-			acc = access.GetAccess(token)
+type Claims struct {
+	Role   string `json:"role"`
+	Tenant string `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Verifier struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+	parser    *jwt.Parser
+}
+
+func New(cfg *config.Auth) (*Verifier, error) {
+	const op = "http-server.middleware.auth.New"
+
+	v := &Verifier{}
+	methods := make([]string, 0, 2)
+
+	if cfg.Secret != "" {
+		v.secret = []byte(cfg.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.PublicKey != "" {
+		data, err := os.ReadFile(cfg.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		v.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		ctx := context.WithValue(r.Context(), UserContextKey, acc)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrNoKey)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(options...)
+
+	return v, nil
+}
+
+// Verify checks the signature and the registered claims of the token and
+// returns the principal it was issued for.
+func (v *Verifier) Verify(token string) (access.Principal, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, v.key)
+	if err != nil {
+		return access.Principal{Access: access.NotAccess}, err
+	}
+	if claims.Tenant == "" {
+		claims.Tenant = tenant.Default
+	}
+	if !tenant.Valid(claims.Tenant) {
+		return access.Principal{Access: access.NotAccess}, ErrInvalidTenant
+	}
+	return access.Principal{
+		Subject: claims.Subject,
+		Tenant:  claims.Tenant,
+		Access:  access.GetAccess(claims.Role),
+	}, nil
+}
+
+func (v *Verifier) key(token *jwt.Token) (interface{}, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.secret, nil
+	case jwt.SigningMethodRS256.Alg():
+		return v.publicKey, nil
+	}
+	return nil, jwt.ErrTokenUnverifiable
+}
+
+func MiddlewareAuth(verifier *Verifier) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := strings.TrimPrefix(r.Header.Get("token"), "Bearer ")
+
+			principal := access.Principal{Access: access.NotAccess}
+			if token != "" {
+				principal, _ = verifier.Verify(token)
+			}
+			ctx := context.WithValue(r.Context(), UserContextKey, principal)
+			if principal.Access != access.NotAccess {
+				ctx = tenant.With(ctx, principal.Tenant)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
 }
@@ -1,28 +1,70 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/AnxVit/avito/internal/config"
 	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/handlers/admin"
 	"github.com/AnxVit/avito/internal/http-server/handlers/banner"
+	"github.com/AnxVit/avito/internal/http-server/handlers/health"
+	"github.com/AnxVit/avito/internal/http-server/handlers/job"
+	"github.com/AnxVit/avito/internal/http-server/handlers/reference"
 	userbanner "github.com/AnxVit/avito/internal/http-server/handlers/user_banner"
+	"github.com/AnxVit/avito/internal/http-server/handlers/variant"
 	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/metrics"
+	"github.com/AnxVit/avito/internal/tracing"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 type Cache interface {
-	GetUserBanner(tag, feature int, useLastReversion bool, admin bool) (map[string]interface{}, error)
+	Ready(ctx context.Context) error
+	GetUserBanner(ctx context.Context, tag, feature int, useLastReversion bool, admin bool) (*models.UserBanner, error)
+	GetUserBanners(ctx context.Context, keys [][2]int, useLastReversion bool) (map[[2]int]*models.UserBanner, error)
+	Inspect(ctx context.Context, limit int) (*models.CacheStats, error)
+	InspectKey(ctx context.Context, tag, feature int) (*models.CacheEntry, error)
+	Purge(ctx context.Context, tag, feature *int) (int, error)
 }
 
 type Repository interface {
-	GetBanner(tag, feature, limit, offset string) ([]models.BannerDB, error)
-	PostBanner(banner *models.BannerPost) (int64, error)
-	PatchBanner(id string, banner *models.BannerPatch) error
-	DeleteBanner(id string) error
+	Ready(ctx context.Context) error
+	GetBanner(ctx context.Context, filter *models.BannerFilter) ([]models.BannerDB, error)
+	PostBanner(ctx context.Context, banner *models.BannerPost) (int64, error)
+	PatchBanner(ctx context.Context, id int64, banner *models.BannerPatch) error
+	DeleteBanner(ctx context.Context, id int64) error
+	GetVersions(ctx context.Context, id int64) ([]models.BannerVersion, error)
+	RestoreVersion(ctx context.Context, id, version int64) error
+	GetTrash(ctx context.Context, limit, offset int64) ([]models.BannerDB, error)
+	RestoreBanner(ctx context.Context, id int64) error
+	GetStats(ctx context.Context, id int64, from, to *time.Time) ([]models.BannerStats, error)
+	GetVariants(ctx context.Context, bannerID int64) ([]models.Variant, error)
+	PostVariant(ctx context.Context, bannerID int64, variant *models.VariantPost) (int64, error)
+	PatchVariant(ctx context.Context, bannerID, variantID int64, variant *models.VariantPatch) error
+	DeleteVariant(ctx context.Context, bannerID, variantID int64) error
+	GetReferences(ctx context.Context, kind models.ReferenceKind, limit, offset int64) ([]models.Reference, error)
+	GetReference(ctx context.Context, kind models.ReferenceKind, id int64) (*models.Reference, error)
+	PostReference(ctx context.Context, kind models.ReferenceKind, reference *models.ReferencePost) (int64, error)
+	PatchReference(ctx context.Context, kind models.ReferenceKind, id int64, reference *models.ReferencePatch) error
+	DeleteReference(ctx context.Context, kind models.ReferenceKind, id int64) error
+	GetFeatureSchema(ctx context.Context, id int64) (json.RawMessage, error)
+	SetFeatureSchema(ctx context.Context, id int64, contentSchema json.RawMessage) error
+}
+
+type Jobs interface {
+	EnqueueDelete(ctx context.Context, feature, tag *int64) (int64, error)
+	GetJob(ctx context.Context, id int64) (*models.Job, error)
+}
+
+type Tracker interface {
+	Impression(ctx context.Context, bannerID int64)
+	Click(ctx context.Context, bannerID int64)
 }
 
 type Server struct {
@@ -30,20 +72,63 @@ type Server struct {
 	Router *chi.Mux
 }
 
-func New(cfg *config.Server, repo Repository, localCache Cache, log *slog.Logger) *Server {
+func New(cfg *config.Server, repo Repository, localCache Cache, jobs Jobs, tracker Tracker, verifier *auth.Verifier, m *metrics.Metrics, log *slog.Logger) *Server {
 	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(m.Middleware)
 	router.Use(middleware.RequestID)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Recoverer)
-	router.Use(auth.MiddlewareAuth)
+	router.Use(deadline(cfg.Timeout))
+
+	router.Get("/healthz", health.NewLive())
+	router.Get("/readyz", health.NewReady(log, repo, localCache))
+	router.Handle(m.Path, m.Handler())
+
+	router.Group(func(r chi.Router) {
+		r.Use(auth.MiddlewareAuth(verifier))
+
+		r.Get("/user_banner", userbanner.New(log, localCache, tracker))
+		r.Post("/user_banner/batch", userbanner.NewBatch(log, localCache, tracker, cfg.MaxBatch))
+		r.Post("/user_banner/click", userbanner.NewClick(log, tracker))
+
+		r.Get("/banner", banner.NewGet(log, repo, cfg.MaxLimit))
+		r.Post("/banner", banner.NewPost(log, repo))
+		r.Delete("/banner", banner.NewBulkDelete(log, jobs))
+		r.Get("/banner/trash", banner.NewGetTrash(log, repo, cfg.MaxLimit))
+
+		r.Patch("/banner/{id}", banner.NewPatch(log, repo))
+		r.Delete("/banner/{id}", banner.NewDelete(log, repo))
+		r.Post("/banner/{id}/restore", banner.NewRestore(log, repo))
 
-	router.Get("/user_banner", userbanner.New(log, localCache))
+		r.Get("/banner/{id}/versions", banner.NewGetVersions(log, repo))
+		r.Post("/banner/{id}/versions/{version}/restore", banner.NewRestoreVersion(log, repo))
 
-	router.Get("/banner", banner.NewGet(log, repo))
-	router.Post("/banner", banner.NewPost(log, repo))
+		r.Get("/banner/{id}/stats", banner.NewGetStats(log, repo))
 
-	router.Patch("/banner/{id}", banner.NewPatch(log, repo))
-	router.Delete("/banner/{id}", banner.NewDelete(log, repo))
+		r.Get("/banner/{id}/variants", variant.NewGet(log, repo))
+		r.Post("/banner/{id}/variants", variant.NewPost(log, repo))
+		r.Patch("/banner/{id}/variants/{variant}", variant.NewPatch(log, repo))
+		r.Delete("/banner/{id}/variants/{variant}", variant.NewDelete(log, repo))
+
+		for _, kind := range []models.ReferenceKind{models.KindFeature, models.KindTag} {
+			r.Get("/"+string(kind), reference.NewList(log, repo, kind, cfg.MaxLimit))
+			r.Post("/"+string(kind), reference.NewPost(log, repo, kind))
+			r.Get("/"+string(kind)+"/{id}", reference.NewGet(log, repo, kind))
+			r.Patch("/"+string(kind)+"/{id}", reference.NewPatch(log, repo, kind))
+			r.Delete("/"+string(kind)+"/{id}", reference.NewDelete(log, repo, kind))
+		}
+
+		r.Get("/feature/{id}/schema", reference.NewGetSchema(log, repo))
+		r.Put("/feature/{id}/schema", reference.NewPutSchema(log, repo))
+		r.Delete("/feature/{id}/schema", reference.NewDeleteSchema(log, repo))
+
+		r.Get("/jobs/{id}", job.NewGet(log, jobs))
+
+		r.Get("/admin/cache", admin.NewGetCache(log, localCache, cfg.MaxLimit))
+		r.Get("/admin/cache/{tag}/{feature}", admin.NewGetCacheKey(log, localCache))
+		r.Delete("/admin/cache", admin.NewPurgeCache(log, localCache))
+	})
 
 	srv := &http.Server{
 		Addr:         cfg.Host + ":" + cfg.Port,
@@ -57,6 +142,28 @@ func New(cfg *config.Server, repo Repository, localCache Cache, log *slog.Logger
 	}
 }
 
+// deadline cancels the request context together with the write timeout, so
+// the queries of a request the server cannot answer anymore are stopped.
+func deadline(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
 func (s *Server) Serve() error {
 	return s.server.ListenAndServe()
 }
+
+// Shutdown stops accepting connections and waits for the active requests
+// until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
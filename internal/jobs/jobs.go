@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+)
+
+type Repository interface {
+	CreateDeleteJob(ctx context.Context, feature, tag *int64) (int64, error)
+	GetJob(ctx context.Context, id int64) (*models.Job, error)
+	NextJob(ctx context.Context, lease time.Duration) (*models.Job, error)
+	DeleteBannersBatch(ctx context.Context, job *models.Job, limit int, lease time.Duration) (int64, error)
+	CountJobBanners(ctx context.Context, job *models.Job) (int64, error)
+	ReleaseJob(ctx context.Context, job *models.Job) error
+	FinishJob(ctx context.Context, job *models.Job, jobErr error) error
+}
+
+// Runner executes bulk delete jobs in the background. The job table is the
+// queue itself: unfinished jobs are picked up again after a restart. Every
+// replica runs a Runner, a job is claimed by one of them for cfg.Lease.
+type Runner struct {
+	DB  Repository
+	log *slog.Logger
+	cfg config.Jobs
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+var (
+	errStopped = errors.New("runner stopped")
+	// errBatchSize fails the job, batches of no banners would never end it
+	errBatchSize = errors.New("batch size must be positive")
+)
+
+func New(cfg *config.Jobs, db Repository, log *slog.Logger) *Runner {
+	return &Runner{
+		DB:   db,
+		log:  log,
+		cfg:  *cfg,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (r *Runner) Start() {
+	go r.run()
+}
+
+// Stop waits for the current batch to finish. The interrupted job keeps its
+// running status, is released and resumed by the next replica that polls.
+func (r *Runner) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Runner) EnqueueDelete(ctx context.Context, feature, tag *int64) (int64, error) {
+	id, err := r.DB.CreateDeleteJob(ctx, feature, tag)
+	if err != nil {
+		return 0, err
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+func (r *Runner) GetJob(ctx context.Context, id int64) (*models.Job, error) {
+	return r.DB.GetJob(ctx, id)
+}
+
+func (r *Runner) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain()
+		select {
+		case <-r.stop:
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) drain() {
+	ctx := context.Background()
+	for {
+		job, err := r.DB.NextJob(ctx, r.cfg.Lease)
+		if err != nil {
+			if !errors.Is(err, storage.ErrJobNotFound) {
+				r.log.Error("failed to get next job", slog.String("error", err.Error()))
+			}
+			return
+		}
+
+		err = r.process(ctx, job)
+		if errors.Is(err, storage.ErrJobClaimed) {
+			r.log.Info("job taken over by another worker", slog.Int64("job", job.ID))
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, errStopped) {
+				r.log.Error("failed to process job", slog.Int64("job", job.ID), slog.String("error", err.Error()))
+			}
+			// a finished job is not claimed anymore, this only matters for an unfinished one
+			if releaseErr := r.DB.ReleaseJob(ctx, job); releaseErr != nil {
+				r.log.Error("failed to release job", slog.Int64("job", job.ID), slog.String("error", releaseErr.Error()))
+			}
+			return
+		}
+	}
+}
+
+// process deletes the banners of the job batch by batch. An empty batch ends
+// the job only when no matching banner is left: the batch skips banners locked
+// by concurrent writes, so the runner backs off up to PollInterval and retries.
+func (r *Runner) process(ctx context.Context, job *models.Job) error {
+	ctx = tenant.With(ctx, job.Tenant)
+	if r.cfg.BatchSize <= 0 {
+		return r.DB.FinishJob(ctx, job, errBatchSize)
+	}
+
+	pause := r.cfg.Pause
+	for {
+		select {
+		case <-r.stop:
+			return errStopped
+		default:
+		}
+
+		deleted, err := r.DB.DeleteBannersBatch(ctx, job, r.cfg.BatchSize, r.cfg.Lease)
+		if err != nil {
+			if errors.Is(err, storage.ErrJobClaimed) {
+				return err
+			}
+			if finishErr := r.DB.FinishJob(ctx, job, err); finishErr != nil {
+				return finishErr
+			}
+			return err
+		}
+
+		if deleted > 0 {
+			pause = r.cfg.Pause
+		} else {
+			remaining, err := r.DB.CountJobBanners(ctx, job)
+			if err != nil {
+				return err
+			}
+			if remaining == 0 {
+				r.log.Info("job done", slog.Int64("job", job.ID), slog.Int64("deleted", job.Deleted))
+				return r.DB.FinishJob(ctx, job, nil)
+			}
+			r.log.Info("job waits for locked banners", slog.Int64("job", job.ID), slog.Int64("remaining", remaining))
+			pause *= 2
+			if pause == 0 || pause > r.cfg.PollInterval {
+				pause = r.cfg.PollInterval
+			}
+		}
+
+		select {
+		case <-r.stop:
+			return errStopped
+		case <-time.After(pause):
+		}
+	}
+}
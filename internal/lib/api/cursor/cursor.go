@@ -0,0 +1,30 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type position struct {
+	ID int64 `json:"id"`
+}
+
+func Encode(id int64) string {
+	b, _ := json.Marshal(position{ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func Decode(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	var p position
+	if err := json.Unmarshal(b, &p); err != nil || p.ID <= 0 {
+		return 0, ErrInvalidCursor
+	}
+	return p.ID, nil
+}
@@ -0,0 +1,25 @@
+package response
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the nginx status for requests the client gave
+// up on before the response was ready.
+const StatusClientClosedRequest = 499
+
+// ContextStatus maps errors caused by the request context to a response
+// status: 499 when the client went away, 503 when the deadline was hit.
+// Other errors give 0.
+func ContextStatus(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return 0
+	}
+}
@@ -1,9 +1,17 @@
 package response
 
+import "github.com/AnxVit/avito/internal/domain/models"
+
 type Response struct {
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
 	ID     int64  `json:"banner_id,omitempty"`
+	JobID  int64  `json:"job_id,omitempty"`
+
+	VariantID   int64                   `json:"variant_id,omitempty"`
+	ReferenceID int64                   `json:"id,omitempty"`
+	Conflicts   []models.BannerConflict `json:"conflicts,omitempty"`
+	Violations  []models.Violation      `json:"violations,omitempty"`
 }
 
 const (
@@ -30,3 +38,40 @@ func ID(id int64) Response {
 		ID:     id,
 	}
 }
+
+func Job(id int64) Response {
+	return Response{
+		Status: StatusOK,
+		JobID:  id,
+	}
+}
+
+func Variant(id int64) Response {
+	return Response{
+		Status:    StatusOK,
+		VariantID: id,
+	}
+}
+
+func Reference(id int64) Response {
+	return Response{
+		Status:      StatusOK,
+		ReferenceID: id,
+	}
+}
+
+func Conflict(msg string, conflicts []models.BannerConflict) Response {
+	return Response{
+		Status:    StatusError,
+		Error:     msg,
+		Conflicts: conflicts,
+	}
+}
+
+func Invalid(msg string, violations []models.Violation) Response {
+	return Response{
+		Status:     StatusError,
+		Error:      msg,
+		Violations: violations,
+	}
+}
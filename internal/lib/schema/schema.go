@@ -0,0 +1,100 @@
+package schema
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	resource = "feature.json"
+
+	// maxCached bounds the compiled schemas kept between calls, there is one
+	// per feature with a schema.
+	maxCached = 256
+)
+
+var ErrInvalidSchema = errors.New("invalid json schema")
+
+var (
+	mu       sync.Mutex
+	compiled = make(map[string]*jsonschema.Schema)
+)
+
+// Compile parses the schema. References to other documents are refused, the
+// schema comes from an admin request and must not make the service read files
+// or fetch URLs.
+func Compile(raw []byte) (*jsonschema.Schema, error) {
+	mu.Lock()
+	s, ok := compiled[string(raw)]
+	mu.Unlock()
+	if ok {
+		return s, nil
+	}
+
+	c := jsonschema.NewCompiler()
+	c.AssertFormat = true
+	c.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external reference %q", url)
+	}
+	if err := c.AddResource(resource, bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err.Error())
+	}
+	s, err := c.Compile(resource)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err.Error())
+	}
+
+	mu.Lock()
+	if len(compiled) >= maxCached {
+		compiled = make(map[string]*jsonschema.Schema)
+	}
+	compiled[string(raw)] = s
+	mu.Unlock()
+	return s, nil
+}
+
+// Validate checks the banner content against the schema and returns the
+// violations ordered by JSON pointer. An empty schema accepts anything.
+func Validate(raw []byte, content map[string]interface{}) ([]models.Violation, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	s, err := Compile(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Validate(content)
+	if err == nil {
+		return nil, nil
+	}
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return nil, err
+	}
+
+	var violations []models.Violation
+	var leaves func(*jsonschema.ValidationError)
+	leaves = func(ve *jsonschema.ValidationError) {
+		if len(ve.Causes) == 0 {
+			violations = append(violations, models.Violation{Pointer: ve.InstanceLocation, Message: ve.Message})
+			return
+		}
+		for _, cause := range ve.Causes {
+			leaves(cause)
+		}
+	}
+	leaves(ve)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Pointer < violations[j].Pointer
+	})
+	return violations, nil
+}
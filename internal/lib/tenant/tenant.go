@@ -0,0 +1,30 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+// Default owns the data created before tenants were introduced and is used
+// for tokens without a tenant claim.
+const Default = "default"
+
+type contextKey struct{}
+
+var valid = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+func Valid(id string) bool {
+	return valid.MatchString(id)
+}
+
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant of the request, Default if none was set.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok {
+		return id
+	}
+	return Default
+}
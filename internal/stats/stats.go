@@ -0,0 +1,212 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+)
+
+// DefaultMaxPending is used when the config sets no positive MaxPending.
+const DefaultMaxPending = 100000
+
+type Repository interface {
+	SaveStats(ctx context.Context, deltas []models.StatsDelta) error
+}
+
+type key struct {
+	tenant   string
+	bannerID int64
+	day      time.Time
+}
+
+type counters struct {
+	impressions int64
+	clicks      int64
+}
+
+// Recorder counts impressions and clicks in memory and writes them to the
+// database in batches, so that serving a banner never waits for the write.
+type Recorder struct {
+	DB  Repository
+	log *slog.Logger
+	cfg config.Stats
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[key]counters
+	// dropped sums the counters that did not fit into MaxPending since the
+	// last flush, the flush logs them
+	dropped counters
+	flushMu sync.Mutex
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func New(cfg *config.Stats, db Repository, log *slog.Logger) *Recorder {
+	if cfg.MaxPending <= 0 {
+		c := *cfg
+		c.MaxPending = DefaultMaxPending
+		cfg = &c
+	}
+	return &Recorder{
+		DB:      db,
+		log:     log,
+		cfg:     *cfg,
+		now:     time.Now,
+		pending: make(map[key]counters),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *Recorder) Start() {
+	go r.run()
+}
+
+// Stop flushes the counters collected so far.
+func (r *Recorder) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Recorder) Impression(ctx context.Context, bannerID int64) {
+	r.add(ctx, bannerID, counters{impressions: 1})
+}
+
+func (r *Recorder) Click(ctx context.Context, bannerID int64) {
+	r.add(ctx, bannerID, counters{clicks: 1})
+}
+
+func (r *Recorder) add(ctx context.Context, bannerID int64, delta counters) {
+	now := r.now().UTC()
+	k := key{
+		tenant:   tenant.FromContext(ctx),
+		bannerID: bannerID,
+		day:      time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+	}
+
+	r.mu.Lock()
+	r.merge(k, delta)
+	full := len(r.pending) >= r.cfg.BatchSize
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// merge adds delta to the pending counters of k. A new key is dropped when
+// MaxPending keys are pending already. r.mu must be held.
+func (r *Recorder) merge(k key, delta counters) {
+	c, ok := r.pending[k]
+	if !ok && len(r.pending) >= r.cfg.MaxPending {
+		r.dropped.impressions += delta.impressions
+		r.dropped.clicks += delta.clicks
+		return
+	}
+	c.impressions += delta.impressions
+	c.clicks += delta.clicks
+	r.pending[k] = c
+}
+
+// Flush writes the pending counters in batches of at most BatchSize, each of
+// one tenant. On failure the unwritten counters are kept for the next attempt
+// as long as they fit into MaxPending.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[key]counters, len(pending))
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	deltas := make(map[string][]models.StatsDelta)
+	for k, c := range pending {
+		deltas[k.tenant] = append(deltas[k.tenant], models.StatsDelta{
+			Tenant:      k.tenant,
+			BannerID:    k.bannerID,
+			Day:         k.day,
+			Impressions: c.impressions,
+			Clicks:      c.clicks,
+		})
+	}
+
+	var errs []error
+	for tenantID, batch := range deltas {
+		for len(batch) > 0 {
+			n := len(batch)
+			if r.cfg.BatchSize > 0 {
+				n = min(n, r.cfg.BatchSize)
+			}
+			// the rest of the tenant waits for the next flush
+			if err := r.DB.SaveStats(tenant.With(ctx, tenantID), batch[:n]); err != nil {
+				errs = append(errs, err)
+				break
+			}
+			for _, delta := range batch[:n] {
+				delete(pending, key{tenant: tenantID, bannerID: delta.BannerID, day: delta.Day})
+			}
+			batch = batch[n:]
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	for k, c := range pending {
+		r.merge(k, c)
+	}
+	r.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			r.flush()
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+		r.flush()
+	}
+}
+
+func (r *Recorder) flush() {
+	if err := r.Flush(context.Background()); err != nil {
+		r.log.Error("failed to flush stats", slog.String("error", err.Error()))
+	}
+
+	r.mu.Lock()
+	dropped := r.dropped
+	r.dropped = counters{}
+	r.mu.Unlock()
+	if dropped != (counters{}) {
+		r.log.Warn("stats dropped, too many pending counters",
+			slog.Int64("impressions", dropped.impressions), slog.Int64("clicks", dropped.clicks))
+	}
+}
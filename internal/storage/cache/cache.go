@@ -1,51 +1,284 @@
 package cache
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/AnxVit/avito/internal/storage/cache/debounce"
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
 )
 
+var tracer = otel.Tracer("github.com/AnxVit/avito/internal/storage/cache")
+
 type Repository interface {
-	GetUserBanner(tag, feature int, admin bool) (map[string]interface{}, error)
+	GetUserBanner(ctx context.Context, tag, feature int, admin bool) (*models.UserBanner, error)
+	GetUserBanners(ctx context.Context, keys [][2]int) (map[[2]int]*models.UserBanner, error)
+	GetUserBannerSnapshot(ctx context.Context, since time.Time, limit int) ([]models.KeyedBanner, error)
 }
 
-type Cache struct {
-	DB       Repository
-	cache    sync.Map
-	debounce map[[2]int]func(f func())
+// Notifier delivers purges to the other instances, which call EvictMatching.
+type Notifier interface {
+	NotifyPurge(ctx context.Context, tag, feature *int) error
 }
 
-func New(db Repository) (*Cache, error) {
-	return &Cache{
-		DB:       db,
-		debounce: make(map[[2]int]func(f func())),
-	}, nil
+type Metrics interface {
+	Hit()
+	Miss()
+	Evict(n int)
 }
 
-func (c *Cache) GetUserBanner(tag, feature int, useLastReversion bool, admin bool) (map[string]interface{}, error) {
-	key := [2]int{tag, feature}
+type nopMetrics struct{}
 
-	if useLastReversion {
-		return c.DB.GetUserBanner(tag, feature, admin)
+func (nopMetrics) Hit()      {}
+func (nopMetrics) Miss()     {}
+func (nopMetrics) Evict(int) {}
+
+type Cache struct {
+	DB          Repository
+	Metrics     Metrics
+	Notifier    Notifier // nil when the instance runs alone
+	store       Store
+	ttl         time.Duration
+	staleTTL    time.Duration
+	negativeTTL time.Duration
+	keyFormat   string
+
+	// group lets one request per key reach the database, the others wait for it
+	group singleflight.Group
+	// gen is bumped by Evict; a fetch that saw an eviction does not store its
+	// result, it may have been read before the write
+	gen atomic.Uint64
+	// ready is false while the Warmer loads the first snapshot
+	ready atomic.Bool
+	// refreshes collects the keys evicted while each Refresh reads its snapshot
+	refreshMu sync.Mutex
+	refreshes map[*refresh]struct{}
+
+	// stats holds the *counters of every tenant, admins see only their own
+	stats sync.Map
+}
+
+func New(cfg *config.Cache, db Repository) (*Cache, error) {
+	const op = "storage.cache.New"
+
+	if strings.Count(cfg.KeyFormat, "%d") != 2 {
+		return nil, fmt.Errorf("%s: key format %q must contain two %%d verbs", op, cfg.KeyFormat)
+	}
+	if cfg.StaleTTL < 0 || cfg.NegativeTTL < 0 {
+		return nil, fmt.Errorf("%s: negative ttl", op)
+	}
+	if cfg.MaxEntries < 0 {
+		return nil, fmt.Errorf("%s: negative max entries", op)
 	}
 
-	bannerInterface, ok := c.cache.Load(key)
-	if !ok {
-		banner, err := c.DB.GetUserBanner(tag, feature, admin)
+	var store Store
+	switch cfg.Backend {
+	case BackendMemory:
+		store = NewMemoryStore(cfg.MaxEntries)
+	case BackendRedis:
+		codec, err := NewCodec(cfg.Codec)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%s: %w", op, err)
 		}
-		c.cache.Store(key, banner)
-		if _, ok := c.debounce[key]; !ok {
-			c.debounce[key] = debounce.New(5 * time.Minute)
+		store = NewRedisStore(&cfg.Redis, codec)
+	default:
+		return nil, fmt.Errorf("%s: unknown backend %q", op, cfg.Backend)
+	}
+
+	c := &Cache{
+		DB:          db,
+		Metrics:     nopMetrics{},
+		store:       store,
+		ttl:         cfg.TTL,
+		staleTTL:    cfg.StaleTTL,
+		negativeTTL: cfg.NegativeTTL,
+		keyFormat:   cfg.KeyFormat,
+		refreshes:   make(map[*refresh]struct{}),
+	}
+	c.ready.Store(true)
+	return c, nil
+}
+
+func (c *Cache) GetUserBanner(ctx context.Context, tag, feature int, useLastReversion bool, admin bool) (*models.UserBanner, error) {
+	const op = "storage.cache.GetUserBanner"
+
+	tenantID := tenant.FromContext(ctx)
+	key := c.key(tenantID, tag, feature)
+
+	ctx, span := tracer.Start(ctx, "cache.GetUserBanner")
+	defer span.End()
+	span.SetAttributes(attribute.String("cache.key", key))
+
+	if useLastReversion {
+		return c.DB.GetUserBanner(ctx, tag, feature, admin)
+	}
+
+	// a failing store must not break banner delivery, so errors are treated as a miss
+	entry, ok, err := c.store.Get(ctx, key)
+	now := time.Now()
+	fresh := err == nil && ok && now.Before(entry.FreshUntil)
+	stale := err == nil && ok && !fresh && c.staleTTL > 0 && entry.Banner != nil
+	span.SetAttributes(attribute.Bool("cache.hit", fresh || stale), attribute.Bool("cache.stale", stale))
+
+	var banner *models.UserBanner
+	switch {
+	case fresh:
+		c.hit(tenantID)
+		if entry.Banner == nil {
+			span.SetAttributes(attribute.Bool("cache.negative", true))
+			return nil, storage.ErrBannerNotFound
 		}
-		c.debounce[key](func() {
-			c.cache.Delete(key)
+		banner = entry.Banner
+	case stale:
+		c.hit(tenantID)
+		banner = entry.Banner
+		// the result is not awaited, DoChan buffers it
+		c.group.DoChan(key, func() (interface{}, error) {
+			return c.fetch(context.WithoutCancel(ctx), key, tag, feature)
 		})
-		return banner, nil
+	default:
+		c.miss(tenantID)
+		// the shared query must not fail because the request that started it went away
+		ch := c.group.DoChan(key, func() (interface{}, error) {
+			return c.fetch(context.WithoutCancel(ctx), key, tag, feature)
+		})
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%s: %w", op, ctx.Err())
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			banner = res.Val.(*models.UserBanner) //nolint:forcetypeassert
+		}
+	}
+
+	// the entry may outlive the banner schedule, so visibility is checked on every hit
+	if !banner.Visible(admin, now) {
+		return nil, storage.ErrNotAccess
+	}
+	return banner, nil
+}
+
+// fetch reads the banner regardless of visibility, so that one cached entry
+// serves users and admins alike, inactive banners included.
+func (c *Cache) fetch(ctx context.Context, key string, tag, feature int) (*models.UserBanner, error) {
+	gen := c.gen.Load()
+	banner, err := c.DB.GetUserBanner(ctx, tag, feature, true)
+	if err != nil {
+		if errors.Is(err, storage.ErrBannerNotFound) {
+			// a stale entry of a banner that is gone must not be served again
+			if c.negativeTTL <= 0 || c.gen.Load() != gen {
+				_ = c.store.Delete(ctx, key)
+			} else {
+				c.setMissing(ctx, key)
+			}
+		}
+		return nil, err
+	}
+	if c.gen.Load() == gen {
+		c.set(ctx, key, banner)
+	}
+	return banner, nil
+}
+
+func (c *Cache) set(ctx context.Context, key string, banner *models.UserBanner) {
+	now := time.Now()
+	_ = c.store.Set(ctx, key, &Entry{Banner: banner, Stored: now, FreshUntil: now.Add(c.ttl)}, c.ttl+c.staleTTL)
+}
+
+// setMissing remembers that the key has no banner. The entry lives for
+// NegativeTTL without a stale period; creating a banner evicts it earlier.
+func (c *Cache) setMissing(ctx context.Context, key string) {
+	now := time.Now()
+	_ = c.store.Set(ctx, key, &Entry{Stored: now, FreshUntil: now.Add(c.negativeTTL)}, c.negativeTTL)
+}
+
+// GetUserBanners serves the {tag, feature} keys from the store and fetches all
+// misses, stale entries included, with a single query. Like the repository it
+// returns the banners regardless of visibility, keys without a banner are
+// missing from the result.
+func (c *Cache) GetUserBanners(ctx context.Context, keys [][2]int, useLastReversion bool) (map[[2]int]*models.UserBanner, error) {
+	ctx, span := tracer.Start(ctx, "cache.GetUserBanners")
+	defer span.End()
+	span.SetAttributes(attribute.Int("cache.keys", len(keys)))
+
+	if useLastReversion {
+		return c.DB.GetUserBanners(ctx, keys)
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	banners := make(map[[2]int]*models.UserBanner, len(keys))
+	misses := make([][2]int, 0, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		entry, ok, err := c.store.Get(ctx, c.key(tenantID, key[0], key[1]))
+		if err != nil || !ok || !now.Before(entry.FreshUntil) {
+			c.miss(tenantID)
+			misses = append(misses, key)
+			continue
+		}
+		c.hit(tenantID)
+		if entry.Banner != nil {
+			banners[key] = entry.Banner
+		}
+	}
+	span.SetAttributes(attribute.Int("cache.misses", len(misses)))
+	if len(misses) == 0 {
+		return banners, nil
+	}
+
+	gen := c.gen.Load()
+	found, err := c.DB.GetUserBanners(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	store := c.gen.Load() == gen
+	for key, banner := range found {
+		if store {
+			c.set(ctx, c.key(tenantID, key[0], key[1]), banner)
+		}
+		banners[key] = banner
 	}
+	if store && c.negativeTTL > 0 {
+		for _, key := range misses {
+			if _, ok := found[key]; !ok {
+				c.setMissing(ctx, c.key(tenantID, key[0], key[1]))
+			}
+		}
+	}
+	return banners, nil
+}
+
+// Evict drops the entries of the tenant's {tag, feature} keys changed by
+// banner writes.
+func (c *Cache) Evict(tenantID string, keys [][2]int) {
+	c.gen.Add(1)
+	// recorded before the delete, so a Refresh storing a key after it checked
+	// the key either skips it or has it deleted here
+	c.evicted(tenantID, keys)
+	for _, key := range keys {
+		_ = c.store.Delete(context.Background(), c.key(tenantID, key[0], key[1]))
+	}
+	c.Metrics.Evict(len(keys))
+}
+
+func (c *Cache) Close() error {
+	return c.store.Close()
+}
 
-	return bannerInterface.(map[string]interface{}), nil //nolint:forcetypeassert
+// key prefixes the configured format with the tenant, tenants never share entries.
+func (c *Cache) key(tenantID string, tag, feature int) string {
+	return tenantID + ":" + fmt.Sprintf(c.keyFormat, tag, feature)
 }
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	CodecJSON = "json"
+	CodecGob  = "gob"
+)
+
+// Codec serializes cache entries for stores living outside the process.
+type Codec interface {
+	Marshal(entry *Entry) ([]byte, error)
+	Unmarshal(data []byte, entry *Entry) error
+}
+
+func init() {
+	// banner content is decoded from JSON, so nested values are maps and slices of interfaces
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+func NewCodec(name string) (Codec, error) {
+	switch name {
+	case CodecJSON:
+		return JSONCodec{}, nil
+	case CodecGob:
+		return GobCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", name)
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(entry *Entry) ([]byte, error) {
+	return json.Marshal(entry)
+}
+
+func (JSONCodec) Unmarshal(data []byte, entry *Entry) error {
+	return json.Unmarshal(data, entry)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) Marshal(entry *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, entry *Entry) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(entry)
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+)
+
+var (
+	ErrNotCached = errors.New("key is not cached")
+	// ErrNotBroadcast is returned with the local count when the purge was
+	// done here but the other instances were not told about it.
+	ErrNotBroadcast = errors.New("purge is not sent to other instances")
+)
+
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func (c *Cache) counters(tenantID string) *counters {
+	if v, ok := c.stats.Load(tenantID); ok {
+		return v.(*counters) //nolint:forcetypeassert
+	}
+	v, _ := c.stats.LoadOrStore(tenantID, &counters{})
+	return v.(*counters) //nolint:forcetypeassert
+}
+
+func (c *Cache) hit(tenantID string) {
+	c.counters(tenantID).hits.Add(1)
+	c.Metrics.Hit()
+}
+
+func (c *Cache) miss(tenantID string) {
+	c.counters(tenantID).misses.Add(1)
+	c.Metrics.Miss()
+}
+
+// Inspect lists the cached keys of the tenant from ctx ordered by tag and
+// feature, at most limit of them when limit is positive. Size counts all.
+func (c *Cache) Inspect(ctx context.Context, limit int) (*models.CacheStats, error) {
+	entries, err := c.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := c.counters(tenant.FromContext(ctx))
+	stats := &models.CacheStats{
+		Size:   len(entries),
+		Hits:   counters.hits.Load(),
+		Misses: counters.misses.Load(),
+		Keys:   entries,
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+	if limit > 0 && len(stats.Keys) > limit {
+		stats.Keys = stats.Keys[:limit]
+	}
+	return stats, nil
+}
+
+// InspectKey describes one cached key together with the cached content.
+func (c *Cache) InspectKey(ctx context.Context, tag, feature int) (*models.CacheEntry, error) {
+	const op = "storage.cache.InspectKey"
+
+	stored, ok, err := c.store.Inspect(ctx, c.key(tenant.FromContext(ctx), tag, feature))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		return nil, ErrNotCached
+	}
+
+	entry := describe(tag, feature, stored, time.Now())
+	if stored.Entry.Banner != nil {
+		entry.Content = stored.Entry.Banner.Content
+	}
+	return &entry, nil
+}
+
+// Purge drops the cached keys of the tenant from ctx, only those of the given
+// tag and feature when they are set, and asks the other instances through the
+// Notifier to do the same. It returns the number of keys dropped here.
+func (c *Cache) Purge(ctx context.Context, tag, feature *int) (int, error) {
+	const op = "storage.cache.Purge"
+
+	n, err := c.purge(ctx, tag, feature)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if c.Notifier != nil {
+		if err := c.Notifier.NotifyPurge(ctx, tag, feature); err != nil {
+			return n, fmt.Errorf("%s: %w: %w", op, ErrNotBroadcast, err)
+		}
+	}
+	return n, nil
+}
+
+// EvictMatching drops the tenant's keys matching tag and feature, it is
+// called for purges made on any instance.
+func (c *Cache) EvictMatching(tenantID string, tag, feature *int) {
+	_, _ = c.purge(tenant.With(context.Background(), tenantID), tag, feature)
+}
+
+func (c *Cache) purge(ctx context.Context, tag, feature *int) (int, error) {
+	entries, err := c.scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([][2]int, 0, len(entries))
+	for _, entry := range entries {
+		if (tag == nil || *tag == entry.Tag) && (feature == nil || *feature == entry.Feature) {
+			keys = append(keys, [2]int{entry.Tag, entry.Feature})
+		}
+	}
+
+	// a purge also stops in-flight fetches from storing what they read
+	c.gen.Add(1)
+	tenantID := tenant.FromContext(ctx)
+	for _, key := range keys {
+		if err := c.store.Delete(ctx, c.key(tenantID, key[0], key[1])); err != nil {
+			return 0, err
+		}
+	}
+	c.Metrics.Evict(len(keys))
+	return len(keys), nil
+}
+
+// scan reads the tenant's entries and parses their keys back into tag and
+// feature, keys not matching the key format are skipped.
+func (c *Cache) scan(ctx context.Context) ([]models.CacheEntry, error) {
+	const op = "storage.cache.scan"
+
+	prefix := tenant.FromContext(ctx) + ":"
+	stored, err := c.store.Scan(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	entries := make([]models.CacheEntry, 0, len(stored))
+	for i := range stored {
+		var tag, feature int
+		rest := strings.TrimPrefix(stored[i].Key, prefix)
+		if n, err := fmt.Sscanf(rest, c.keyFormat, &tag, &feature); err != nil || n != 2 {
+			continue
+		}
+		entries = append(entries, describe(tag, feature, &stored[i], now))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Tag != entries[j].Tag {
+			return entries[i].Tag < entries[j].Tag
+		}
+		return entries[i].Feature < entries[j].Feature
+	})
+	return entries, nil
+}
+
+func describe(tag, feature int, stored *StoredEntry, now time.Time) models.CacheEntry {
+	entry := models.CacheEntry{
+		Tag:        tag,
+		Feature:    feature,
+		StoredAt:   stored.Entry.Stored,
+		FreshUntil: stored.Entry.FreshUntil,
+		ExpiresAt:  stored.ExpiresAt,
+		Stale:      !now.Before(stored.Entry.FreshUntil),
+	}
+	if !stored.Entry.Stored.IsZero() {
+		entry.AgeSeconds = now.Sub(stored.Entry.Stored).Seconds()
+	}
+	if stored.Entry.Banner != nil {
+		id := stored.Entry.Banner.ID
+		entry.BannerID = &id
+	}
+	return entry
+}
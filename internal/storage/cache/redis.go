@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const scanCount = 100
+
+// globEscaper keeps a tenant or key format from acting as a SCAN pattern.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// RedisStore keeps banners in any server speaking the Redis protocol,
+// so every replica shares the same entries.
+type RedisStore struct {
+	client *redis.Client
+	codec  Codec
+}
+
+func NewRedisStore(cfg *config.Redis, codec Codec) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     cfg.Addr,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		codec: codec,
+	}
+}
+
+func (r *RedisStore) Get(ctx context.Context, key string) (*Entry, bool, error) {
+	data, err := r.client.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	var entry Entry
+	if err := r.codec.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+func (r *RedisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	data, err := r.codec.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, data, ttl).Err()
+}
+
+func (r *RedisStore) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *RedisStore) Inspect(ctx context.Context, key string) (*StoredEntry, bool, error) {
+	entries, err := r.inspect(ctx, []string{key})
+	if err != nil || len(entries) == 0 {
+		return nil, false, err
+	}
+	return &entries[0], true, nil
+}
+
+func (r *RedisStore) Scan(ctx context.Context, prefix string) ([]StoredEntry, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, globEscaper.Replace(prefix)+"*", scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return r.inspect(ctx, keys)
+}
+
+// inspect reads the keys with their expiry in one round trip, keys gone
+// meanwhile are skipped.
+func (r *RedisStore) inspect(ctx context.Context, keys []string) ([]StoredEntry, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := r.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := make([]StoredEntry, 0, len(keys))
+	for i, key := range keys {
+		data, err := gets[i].Bytes()
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := r.codec.Unmarshal(data, &entry); err != nil {
+			return nil, err
+		}
+		stored := StoredEntry{Key: key, Entry: &entry}
+		if ttl := ttls[i].Val(); ttl > 0 {
+			stored.ExpiresAt = now.Add(ttl)
+		}
+		entries = append(entries, stored)
+	}
+	return entries, nil
+}
+
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+)
+
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// DefaultMaxEntries bounds the memory store when cache.maxEntries is not set.
+const DefaultMaxEntries = 10000
+
+// Entry is a cached banner. The store keeps it for the TTL plus the stale
+// period, FreshUntil tells the two apart.
+type Entry struct {
+	Banner     *models.UserBanner
+	Stored     time.Time
+	FreshUntil time.Time
+}
+
+// StoredEntry is an entry as the store keeps it, for inspection.
+type StoredEntry struct {
+	Key       string
+	Entry     *Entry
+	ExpiresAt time.Time
+}
+
+type Store interface {
+	Get(ctx context.Context, key string) (*Entry, bool, error)
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// Inspect reads an entry without touching its position or expiry.
+	Inspect(ctx context.Context, key string) (*StoredEntry, bool, error)
+	// Scan returns the live entries whose keys start with prefix.
+	Scan(ctx context.Context, prefix string) ([]StoredEntry, error)
+	Close() error
+}
+
+// MemoryStore is an LRU of at most maxEntries entries. Expired entries are
+// dropped when they are read or pushed out by new ones, no timers are kept.
+type MemoryStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	items      map[string]*list.Element
+	order      *list.List // front is the most recently used
+	now        func() time.Time
+}
+
+type memoryItem struct {
+	key       string
+	entry     *Entry
+	expiresAt time.Time
+}
+
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	return &MemoryStore{
+		maxEntries: maxEntries,
+		items:      make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, key string) (*Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := elem.Value.(*memoryItem) //nolint:forcetypeassert
+	if !m.now().Before(item.expiresAt) {
+		m.remove(elem)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(elem)
+	return item.entry, true, nil
+}
+
+func (m *MemoryStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expiresAt := m.now().Add(ttl)
+	if elem, ok := m.items[key]; ok {
+		item := elem.Value.(*memoryItem) //nolint:forcetypeassert
+		item.entry = entry
+		item.expiresAt = expiresAt
+		m.order.MoveToFront(elem)
+		return nil
+	}
+
+	m.items[key] = m.order.PushFront(&memoryItem{key: key, entry: entry, expiresAt: expiresAt})
+	for m.order.Len() > m.maxEntries {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.items[key]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Inspect(ctx context.Context, key string) (*StoredEntry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	item := elem.Value.(*memoryItem) //nolint:forcetypeassert
+	if !m.now().Before(item.expiresAt) {
+		return nil, false, nil
+	}
+	return &StoredEntry{Key: key, Entry: item.entry, ExpiresAt: item.expiresAt}, true, nil
+}
+
+func (m *MemoryStore) Scan(ctx context.Context, prefix string) ([]StoredEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	entries := make([]StoredEntry, 0)
+	for elem := m.order.Front(); elem != nil; elem = elem.Next() {
+		item := elem.Value.(*memoryItem) //nolint:forcetypeassert
+		if !strings.HasPrefix(item.key, prefix) || !now.Before(item.expiresAt) {
+			continue
+		}
+		entries = append(entries, StoredEntry{Key: item.key, Entry: item.entry, ExpiresAt: item.expiresAt})
+	}
+	return entries, nil
+}
+
+// Len returns the number of entries, expired ones that were not read yet
+// included.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *MemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items = make(map[string]*list.Element)
+	m.order.Init()
+	return nil
+}
+
+func (m *MemoryStore) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.items, elem.Value.(*memoryItem).key) //nolint:forcetypeassert
+}
@@ -0,0 +1,177 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+)
+
+var ErrWarming = errors.New("cache is warming up")
+
+// Ready reports ErrWarming until the first warm-up has finished.
+func (c *Cache) Ready(ctx context.Context) error {
+	if !c.ready.Load() {
+		return ErrWarming
+	}
+	return nil
+}
+
+// Refresh loads the snapshot of the tenant from ctx with one query and stores
+// every banner in it. The least shown banners are stored first, so a bounded
+// store drops them first. Keys evicted by writes during the query may hold
+// banners read before the write, they are skipped; purges leave the banners
+// as they are and do not matter. It returns the number of stored keys.
+func (c *Cache) Refresh(ctx context.Context, since time.Time, limit int) (int, error) {
+	tenantID := tenant.FromContext(ctx)
+	r := &refresh{tenant: tenantID, evicted: make(map[[2]int]struct{})}
+	c.refreshMu.Lock()
+	c.refreshes[r] = struct{}{}
+	c.refreshMu.Unlock()
+	defer func() {
+		c.refreshMu.Lock()
+		delete(c.refreshes, r)
+		c.refreshMu.Unlock()
+	}()
+
+	banners, err := c.DB.GetUserBannerSnapshot(ctx, since, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	stored := make([][2]int, 0, len(banners))
+	for i := len(banners) - 1; i >= 0; i-- {
+		key := [2]int{banners[i].Key.Tag, banners[i].Key.Feature}
+		if c.wasEvicted(r, key) {
+			continue
+		}
+		c.set(ctx, c.key(tenantID, key[0], key[1]), banners[i].Banner)
+		stored = append(stored, key)
+	}
+
+	// an eviction between the check and the set must still win
+	n := len(stored)
+	for _, key := range stored {
+		if c.wasEvicted(r, key) {
+			_ = c.store.Delete(ctx, c.key(tenantID, key[0], key[1]))
+			n--
+		}
+	}
+	return n, nil
+}
+
+type refresh struct {
+	tenant  string
+	evicted map[[2]int]struct{}
+}
+
+func (c *Cache) wasEvicted(r *refresh, key [2]int) bool {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	_, ok := r.evicted[key]
+	return ok
+}
+
+// evicted records the keys in the running refreshes of the tenant.
+func (c *Cache) evicted(tenantID string, keys [][2]int) {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	for r := range c.refreshes {
+		if r.tenant != tenantID {
+			continue
+		}
+		for _, key := range keys {
+			r.evicted[key] = struct{}{}
+		}
+	}
+}
+
+// Warmer fills the cache on start and refreshes it in the background.
+type Warmer struct {
+	cache *Cache
+	log   *slog.Logger
+	cfg   config.Warmup
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWarmer holds the readiness of the cache until Start has warmed it up.
+func NewWarmer(cfg *config.Warmup, c *Cache, log *slog.Logger) *Warmer {
+	if cfg.Enabled {
+		c.ready.Store(false)
+	}
+	return &Warmer{
+		cache: c,
+		log:   log,
+		cfg:   *cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+func (w *Warmer) Start() {
+	go w.run()
+}
+
+func (w *Warmer) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Warm refreshes the cache of every configured tenant. A failed warm-up still
+// makes the cache ready, the banners are then read from the database.
+func (w *Warmer) Warm(ctx context.Context) error {
+	defer w.cache.ready.Store(true)
+
+	if w.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.cfg.Timeout)
+		defer cancel()
+	}
+
+	since := time.Now().Add(-w.cfg.Window)
+	var errs []error
+	for _, tenantID := range w.cfg.Tenants {
+		n, err := w.cache.Refresh(tenant.With(ctx, tenantID), since, w.cfg.Limit)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		w.log.Debug("cache refreshed", slog.String("tenant", tenantID), slog.Int("banners", n))
+	}
+	return errors.Join(errs...)
+}
+
+func (w *Warmer) run() {
+	defer close(w.done)
+
+	if w.cfg.Enabled {
+		w.warm()
+	}
+	if w.cfg.RefreshInterval <= 0 {
+		<-w.stop
+		return
+	}
+
+	ticker := time.NewTicker(w.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.warm()
+		}
+	}
+}
+
+func (w *Warmer) warm() {
+	if err := w.Warm(context.Background()); err != nil {
+		w.log.Error("failed to warm up cache", slog.String("error", err.Error()))
+	}
+}
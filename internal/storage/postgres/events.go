@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AnxVit/avito/internal/lib/tenant"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// changesChannel carries the {tag, feature} keys touched by banner writes
+// to every instance listening on the database.
+const changesChannel = "banner_changes"
+
+// notify payloads are limited to 8000 bytes, keys are sent in chunks well below it.
+const keysPerNotification = 400
+
+type changes struct {
+	Tenant string   `json:"tenant"`
+	Keys   [][2]int `json:"keys,omitempty"`
+	// Purge is set instead of Keys when an admin purged the tenant's cache
+	Purge *purge `json:"purge,omitempty"`
+}
+
+// purge carries the filter of an admin purge, nil fields match every key.
+type purge struct {
+	Tag     *int `json:"tag_id,omitempty"`
+	Feature *int `json:"feature_id,omitempty"`
+}
+
+// Subscribe registers f to be called with the tenant and the {tag, feature}
+// keys of banners changed by this instance and, while Listen runs, by other
+// instances.
+func (s *Repo) Subscribe(f func(tenant string, keys [][2]int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, f)
+}
+
+// SubscribePurge registers f to be called with the tenant and the filter of
+// cache purges published by NotifyPurge while Listen runs, the purging
+// instance included.
+func (s *Repo) SubscribePurge(f func(tenant string, tag, feature *int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purgers = append(s.purgers, f)
+}
+
+// Listen delivers changes published by other instances until ctx is done.
+func (s *Repo) Listen(ctx context.Context) error {
+	for {
+		// notifications sent while reconnecting are lost, cache entries expire by TTL anyway
+		_ = s.listen(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *Repo) listen(ctx context.Context) error {
+	conn, err := s.DB.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// the connection keeps listening state, so it is never returned to the pool
+	pgConn := conn.Hijack()
+	s.tenants.forget(pgConn)
+	defer pgConn.Close(context.Background())
+
+	_, err = pgConn.Exec(ctx, "LISTEN "+changesChannel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := pgConn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var c changes
+		if err := json.Unmarshal([]byte(notification.Payload), &c); err != nil {
+			continue
+		}
+		if c.Purge != nil {
+			s.publishPurge(c.Tenant, c.Purge)
+			continue
+		}
+		s.publish(c.Tenant, c.Keys)
+	}
+}
+
+func (s *Repo) publish(tenant string, keys [][2]int) {
+	if len(keys) == 0 {
+		return
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, f := range s.subscribers {
+		f(tenant, keys)
+	}
+}
+
+func (s *Repo) publishPurge(tenant string, p *purge) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, f := range s.purgers {
+		f(tenant, p.Tag, p.Feature)
+	}
+}
+
+// bannerKeys returns the {tag, feature} keys under which users can reach the banners.
+func bannerKeys(ctx context.Context, tx pgx.Tx, ids []int64) ([][2]int, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT DISTINCT
+			bannertag.tagid,
+			banner.feature
+		FROM banner
+		INNER JOIN bannertag ON bannertag.BannerID = banner.id
+		WHERE banner.id = ANY($1::bigint[])
+			AND banner.feature IS NOT NULL
+			AND bannertag.tagid IS NOT NULL;`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys [][2]int
+	for rows.Next() {
+		var key [2]int
+		if err := rows.Scan(&key[0], &key[1]); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// notifyChanges queues the keys for delivery to listeners, postgres sends
+// them only when the transaction commits.
+func notifyChanges(ctx context.Context, tx pgx.Tx, tenant string, keys [][2]int) error {
+	for len(keys) > 0 {
+		n := min(len(keys), keysPerNotification)
+		payload, err := json.Marshal(changes{Tenant: tenant, Keys: keys[:n]})
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2);`, changesChannel, string(payload))
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// NotifyPurge asks every listening instance to drop the cached keys of the
+// tenant matching tag and feature, each of them scans its own cache.
+func (s *Repo) NotifyPurge(ctx context.Context, tag, feature *int) error {
+	const op = "storage.postgres.NotifyPurge"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	payload, err := json.Marshal(changes{
+		Tenant: tenant.FromContext(ctx),
+		Purge:  &purge{Tag: tag, Feature: feature},
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	_, err = s.DB.Exec(ctx, `SELECT pg_notify($1, $2);`, changesChannel, string(payload))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func mergeKeys(a, b [][2]int) [][2]int {
+	seen := make(map[[2]int]struct{}, len(a)+len(b))
+	merged := make([][2]int, 0, len(a)+len(b))
+	for _, keys := range [][][2]int{a, b} {
+		for _, key := range keys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			merged = append(merged, key)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,37 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+)
+
+// SchemaVersion is the version of the latest file in migrations/.
+const SchemaVersion int64 = 20240424120000
+
+// Ready checks that the database is reachable and migrated at least up to
+// SchemaVersion.
+func (s *Repo) Ready(ctx context.Context) error {
+	const op = "storage.postgres.Ready"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if err := s.DB.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var version int64
+	err := s.DB.QueryRow(ctx,
+		`SELECT COALESCE(MAX(version_id), 0) FROM goose_db_version WHERE is_applied;`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("%s: schema version %d, expected %d", op, version, SchemaVersion)
+	}
+	return nil
+}
+
+func (s *Repo) Close() {
+	s.DB.Close()
+}
@@ -3,21 +3,35 @@ package postgres
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/AnxVit/avito/internal/config"
 	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/schema"
+	"github.com/AnxVit/avito/internal/lib/tenant"
 	"github.com/AnxVit/avito/internal/storage"
+	"github.com/AnxVit/avito/internal/tracing"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Repo struct {
-	DB *pgxpool.Pool
+	DB           *pgxpool.Pool
+	VersionLimit int
+	QueryTimeout time.Duration
+
+	tenants *tenantConns
+
+	mu          sync.RWMutex
+	subscribers []func(tenant string, keys [][2]int)
+	purgers     []func(tenant string, tag, feature *int)
 }
 
 func New(storage *config.DB) (*Repo, error) {
@@ -25,81 +39,266 @@ func New(storage *config.DB) (*Repo, error) {
 	psqlInfo := fmt.Sprintf("user=%s password=%s host=%s "+
 		"port=%d dbname=%s sslmode=disable",
 		storage.User, storage.Password, storage.Host, storage.Port, storage.DBName)
-	db, err := pgxpool.New(context.Background(), psqlInfo)
+	poolCfg, err := pgxpool.ParseConfig(psqlInfo)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	poolCfg.ConnConfig.Tracer = tracing.QueryTracer{}
+
+	tenants := &tenantConns{}
+	poolCfg.BeforeAcquire = tenants.beforeAcquire
+	poolCfg.BeforeClose = tenants.forget
+
+	db, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return &Repo{
-		DB: db,
+		DB:           db,
+		VersionLimit: storage.VersionLimit,
+		QueryTimeout: storage.QueryTimeout,
+		tenants:      tenants,
 	}, nil
 }
 
-func (s *Repo) GetUserBanner(tag, feature int, admin bool) (map[string]interface{}, error) {
+// withTimeout bounds a repository call by QueryTimeout on top of the caller's
+// deadline. Zero disables the limit.
+func (s *Repo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.QueryTimeout)
+}
+
+func (s *Repo) GetUserBanner(ctx context.Context, tag, feature int, admin bool) (*models.UserBanner, error) {
 	const op = "storage.postgres.GetUserBanner"
 
-	var banner map[string]interface{}
-	var access *bool
-	err := s.DB.QueryRow(context.Background(),
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var banner models.UserBanner
+	err := s.DB.QueryRow(ctx,
 		`SELECT 
+			id,
 			content,
-		 	access 
+		 	access,
+			active_from,
+			active_until,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', bannervariant.id,
+					'weight', bannervariant.weight,
+					'content', bannervariant.content
+				) ORDER BY bannervariant.id)
+				FROM bannervariant
+				WHERE bannervariant.BannerID = banner.id
+			), '[]')
 		FROM banner
-		WHERE feature = $1 AND id = ANY(
+		WHERE tenant_id = $3 AND feature = $1 AND deleted_at IS NULL AND id = ANY(
 			SELECT 
 				BannerID
 			FROM 
 				bannertag
 			WHERE TagID = $2
-			);`, feature, tag).Scan(&banner, &access)
+			);`, feature, tag, tenant.FromContext(ctx)).Scan(&banner.ID, &banner.Content, &banner.Access, &banner.ActiveFrom, &banner.ActiveUntil, &banner.Variants)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, storage.ErrBannerNotFound
 		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	if access == nil || (!*access && !admin) {
+	if !banner.Visible(admin, time.Now()) {
 		return nil, storage.ErrNotAccess
 	}
-	return banner, nil
+	return &banner, nil
 }
 
-func (s *Repo) GetBanner(tag, feature, limit, offset string) ([]models.BannerDB, error) {
+// GetUserBanners looks up the banners of all {tag, feature} keys in one query.
+// Keys without a banner are missing from the result; visibility is left to
+// the caller, so that inactive banners can be told apart from missing ones.
+func (s *Repo) GetUserBanners(ctx context.Context, keys [][2]int) (map[[2]int]*models.UserBanner, error) {
+	const op = "storage.postgres.GetUserBanners"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tags := make([]int, 0, len(keys))
+	features := make([]int, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, key[0])
+		features = append(features, key[1])
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			k.tag,
+			k.feature,
+			banner.id,
+			banner.content,
+			banner.access,
+			banner.active_from,
+			banner.active_until,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', bannervariant.id,
+					'weight', bannervariant.weight,
+					'content', bannervariant.content
+				) ORDER BY bannervariant.id)
+				FROM bannervariant
+				WHERE bannervariant.BannerID = banner.id
+			), '[]')
+		FROM unnest($1::int[], $2::int[]) AS k(tag, feature)
+		INNER JOIN bannertag ON bannertag.TagID = k.tag AND bannertag.feature = k.feature
+		INNER JOIN banner ON banner.id = bannertag.BannerID
+		WHERE banner.tenant_id = $3 AND banner.deleted_at IS NULL;`, tags, features, tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	banners := make(map[[2]int]*models.UserBanner, len(keys))
+	for rows.Next() {
+		var key [2]int
+		var banner models.UserBanner
+		err = rows.Scan(&key[0], &key[1], &banner.ID, &banner.Content, &banner.Access,
+			&banner.ActiveFrom, &banner.ActiveUntil, &banner.Variants)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		banners[key] = &banner
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return banners, nil
+}
+
+// GetUserBannerSnapshot returns the active banners of the tenant under every
+// {tag, feature} key, most shown during the window since first. A positive
+// limit keeps only that many keys.
+func (s *Repo) GetUserBannerSnapshot(ctx context.Context, since time.Time, limit int) ([]models.KeyedBanner, error) {
+	const op = "storage.postgres.GetUserBannerSnapshot"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			bannertag.tagid,
+			bannertag.feature,
+			banner.id,
+			banner.content,
+			banner.access,
+			banner.active_from,
+			banner.active_until,
+			COALESCE((
+				SELECT json_agg(json_build_object(
+					'id', bannervariant.id,
+					'weight', bannervariant.weight,
+					'content', bannervariant.content
+				) ORDER BY bannervariant.id)
+				FROM bannervariant
+				WHERE bannervariant.BannerID = banner.id
+			), '[]')
+		FROM banner
+		INNER JOIN bannertag ON bannertag.BannerID = banner.id
+		LEFT JOIN (
+			SELECT bannerid, SUM(impressions) AS impressions
+			FROM bannerstats
+			WHERE day >= $2::date
+			GROUP BY bannerid
+		) traffic ON traffic.bannerid = banner.id
+		WHERE banner.tenant_id = $1
+			AND banner.deleted_at IS NULL
+			AND banner.access
+			AND bannertag.tagid IS NOT NULL
+			AND bannertag.feature IS NOT NULL
+		ORDER BY COALESCE(traffic.impressions, 0) DESC, banner.id, bannertag.tagid
+		LIMIT $3::bigint;`, tenant.FromContext(ctx), since, limitArg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	banners := make([]models.KeyedBanner, 0)
+	for rows.Next() {
+		var key models.BannerKey
+		var banner models.UserBanner
+		err = rows.Scan(&key.Tag, &key.Feature, &banner.ID, &banner.Content, &banner.Access,
+			&banner.ActiveFrom, &banner.ActiveUntil, &banner.Variants)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		banners = append(banners, models.KeyedBanner{Key: key, Banner: &banner})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return banners, nil
+}
+
+func (s *Repo) GetBanner(ctx context.Context, filter *models.BannerFilter) ([]models.BannerDB, error) {
 	const op = "storage.postgres.GetBanner"
 
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
 	var buffer bytes.Buffer
 
 	query := `
 	SELECT 
 		id,
 		array_agg(bannertag.tagid) tag,
-		feature,
+		banner.feature,
 		content,
 		access,
+		active_from,
+		active_until,
 		created_at,
 		updated_at
 		FROM banner
 		INNER JOIN bannertag ON bannertag.BannerID = banner.id
 	`
 	buffer.WriteString(query)
-	if feature != "" {
-		buffer.WriteString(" WHERE feature = " + feature)
+
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
 	}
+
+	where := []string{"tenant_id = " + arg(tenant.FromContext(ctx)), "deleted_at IS NULL"}
+	if filter.Feature != 0 {
+		where = append(where, "banner.feature = "+arg(filter.Feature)+"::bigint")
+	}
+	if filter.AfterID != 0 {
+		where = append(where, "id > "+arg(filter.AfterID)+"::bigint")
+	}
+	if filter.ActiveAt != nil {
+		at := arg(*filter.ActiveAt)
+		where = append(where, "(active_from IS NULL OR active_from <= "+at+") AND (active_until IS NULL OR active_until > "+at+")")
+	}
+	buffer.WriteString(" WHERE " + strings.Join(where, " AND "))
 	buffer.WriteString(" GROUP BY id")
-	if tag != "" {
-		buffer.WriteString(` HAVING ` + tag + ` = ANY(array_agg(bannertag.TagID))`)
+	if filter.Tag != 0 {
+		buffer.WriteString(" HAVING " + arg(filter.Tag) + "::bigint = ANY(array_agg(bannertag.TagID))")
 	}
 	buffer.WriteString(" ORDER BY id")
-	if limit != "" {
-		buffer.WriteString(" LIMIT " + limit)
+	if filter.Limit != 0 {
+		buffer.WriteString(" LIMIT " + arg(filter.Limit))
 	}
-
-	if offset != "" {
-		buffer.WriteString(" OFFSET " + offset)
+	if filter.Offset != 0 {
+		buffer.WriteString(" OFFSET " + arg(filter.Offset))
 	}
 	buffer.WriteString(";")
 
-	rows, err := s.DB.Query(context.Background(), buffer.String())
+	rows, err := s.DB.Query(ctx, buffer.String(), args...)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -109,29 +308,58 @@ func (s *Repo) GetBanner(tag, feature, limit, offset string) ([]models.BannerDB,
 
 	for rows.Next() {
 		var banner models.BannerDB
-		err = rows.Scan(&banner.ID, &banner.Tag, &banner.Feature, &banner.Content, &banner.Access, &banner.Created, &banner.Updated)
+		err = rows.Scan(&banner.ID, &banner.Tag, &banner.Feature, &banner.Content, &banner.Access,
+			&banner.ActiveFrom, &banner.ActiveUntil, &banner.Created, &banner.Updated)
 		if err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		banners = append(banners, banner)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 	return banners, nil
 }
 
-func (s *Repo) PostBanner(banner *models.BannerPost) (int64, error) {
+func (s *Repo) PostBanner(ctx context.Context, banner *models.BannerPost) (int64, error) {
 	const op = "storage.postgres.PostBanner"
 
-	tx, err := s.DB.Begin(context.Background())
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tenantID := tenant.FromContext(ctx)
+
+	if banner.CreateMissing {
+		err = createReferences(ctx, tx, models.KindFeature, tenantID, []int64{banner.Feature})
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		err = createReferences(ctx, tx, models.KindTag, tenantID, banner.Tag)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	err = checkReferences(ctx, tx, tenantID, &banner.Feature, banner.Tag)
 	if err != nil {
+		if errors.Is(err, storage.ErrReferenceNotFound) {
+			return 0, err
+		}
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
-	defer tx.Rollback(context.Background())
 
-	execQuery := `INSERT INTO banner(feature, content, access)
-			VALUES ($1, $2, $3)
+	execQuery := `INSERT INTO banner(tenant_id, feature, content, access, active_from, active_until)
+			VALUES ($1, $2, $3, $4, $5, $6)
 			RETURNING id;`
 
-	row := tx.QueryRow(context.Background(), execQuery, banner.Feature, banner.Content, banner.Access)
+	row := tx.QueryRow(ctx, execQuery,
+		tenantID, banner.Feature, banner.Content, banner.Access, banner.ActiveFrom, banner.ActiveUntil)
 
 	var id int64
 
@@ -142,76 +370,116 @@ func (s *Repo) PostBanner(banner *models.BannerPost) (int64, error) {
 
 	execQuery = `INSERT INTO bannertag(bannerid, tagid) VALUES ($1, $2)`
 	for _, tag := range banner.Tag {
-		_, err = tx.Exec(context.Background(), execQuery, id, tag)
+		_, err = tx.Exec(ctx, execQuery, id, tag)
 		if err != nil {
 			return 0, fmt.Errorf("%s: %w", op, err)
 		}
 	}
 
-	_ = tx.Commit(context.Background())
+	if err = checkContent(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrInvalidContent) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = checkConflicts(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrBannerConflict) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		if pairTaken(err) {
+			return 0, &storage.ConflictError{}
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(tenantID, keys)
 	return id, nil
 }
 
-func (s *Repo) PatchBanner(id string, banner *models.BannerPatch) error {
+func (s *Repo) PatchBanner(ctx context.Context, id int64, banner *models.BannerPatch) error {
 	const op = "storage.postgres.PatchBanner"
 
-	tx, err := s.DB.Begin(context.Background())
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
 
-	updateQuery := `UPDATE banner `
-	i := 0
-	var buffer bytes.Buffer
-	buffer.WriteString(updateQuery)
+	tenantID := tenant.FromContext(ctx)
 
-	if banner.Feature.Defined {
-		buffer.WriteString("SET ")
-		if banner.Feature.Value == nil {
-			buffer.WriteString(`feature = NULL`)
-		} else {
-			buffer.WriteString(`feature = ` + strconv.Itoa(int(*banner.Feature.Value)))
+	err = s.saveVersion(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrBannerNotFound) {
+			return err
 		}
-		i++
+		return fmt.Errorf("%s: %w", op, err)
 	}
-	if banner.Content.Defined {
-		if i > 0 {
-			buffer.WriteString(", ")
-		} else {
-			buffer.WriteString("SET ")
-		}
-		if banner.Content.Value == nil {
-			buffer.WriteString(`content = NULL`)
-		} else {
-			b, _ := json.Marshal(banner.Content.Value)
-			buffer.WriteString(`content = '` + string(b) + "'")
+
+	var feature *int64
+	if banner.Feature.Defined {
+		feature = banner.Feature.Value
+	}
+	var tags []int64
+	if banner.Tag.Defined && banner.Tag.Value != nil {
+		tags = *banner.Tag.Value
+	}
+	err = checkReferences(ctx, tx, tenantID, feature, tags)
+	if err != nil {
+		if errors.Is(err, storage.ErrReferenceNotFound) {
+			return err
 		}
-		i++
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	oldKeys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	args := []interface{}{id, tenantID}
+	set := []string{"updated_at = NOW()"}
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		set = append(set, name+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if banner.Feature.Defined {
+		column("feature", banner.Feature.Value)
+	}
+	if banner.Content.Defined {
+		column("content", banner.Content.Value)
+	}
 	if banner.Access.Defined {
-		if i > 0 {
-			buffer.WriteString(", ")
-		} else {
-			buffer.WriteString("SET ")
-		}
-		if banner.Access.Value == nil {
-			buffer.WriteString(`access = NULL`)
-		} else {
-			buffer.WriteString(`access = ` + strconv.FormatBool(*banner.Access.Value))
-		}
+		column("access", banner.Access.Value)
+	}
+	if banner.ActiveFrom.Defined {
+		column("active_from", banner.ActiveFrom.Value)
 	}
-	if i > 0 {
-		buffer.WriteString(", ")
-	} else {
-		buffer.WriteString("SET ")
+	if banner.ActiveUntil.Defined {
+		column("active_until", banner.ActiveUntil.Value)
 	}
-	buffer.WriteString(` updated_at = NOW()`)
-	buffer.WriteString(` WHERE id = ` + id + `;`)
 
-	res, err := tx.Exec(context.Background(), buffer.String())
+	res, err := tx.Exec(ctx,
+		`UPDATE banner SET `+strings.Join(set, ", ")+` WHERE id = $1 AND tenant_id = $2;`, args...)
 	if err != nil {
+		if scheduleViolated(err) {
+			return storage.ErrInvalidSchedule
+		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -222,20 +490,20 @@ func (s *Repo) PatchBanner(id string, banner *models.BannerPatch) error {
 	}
 
 	if banner.Tag.Defined {
-		_, err = tx.Exec(context.Background(), "DELETE FROM bannertag WHERE bannerid = "+id)
+		_, err = tx.Exec(ctx, `DELETE FROM bannertag WHERE bannerid = $1;`, id)
 		if err != nil {
 			return fmt.Errorf("%s: %w", op, err)
 		}
 
 		execQuery := `INSERT INTO bannertag(bannerid, tagid) VALUES ($1, $2)`
 		if banner.Tag.Value == nil {
-			_, err = tx.Exec(context.Background(), execQuery, id, nil)
+			_, err = tx.Exec(ctx, execQuery, id, nil)
 			if err != nil {
 				return fmt.Errorf("%s: %w", op, err)
 			}
 		} else {
 			for _, tag := range *banner.Tag.Value {
-				_, err = tx.Exec(context.Background(), execQuery, id, tag)
+				_, err = tx.Exec(ctx, execQuery, id, tag)
 				if err != nil {
 					return fmt.Errorf("%s: %w", op, err)
 				}
@@ -243,14 +511,62 @@ func (s *Repo) PatchBanner(id string, banner *models.BannerPatch) error {
 		}
 	}
 
-	_ = tx.Commit(context.Background())
+	if err = checkContent(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrInvalidContent) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = checkConflicts(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrBannerConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	newKeys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	keys := mergeKeys(oldKeys, newKeys)
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		if pairTaken(err) {
+			return &storage.ConflictError{}
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(tenantID, keys)
 
 	return nil
 }
 
-func (s *Repo) DeleteBanner(id string) error {
+func (s *Repo) DeleteBanner(ctx context.Context, id int64) error {
 	const op = "storage.postgres.DeleteBanner"
-	res, err := s.DB.Exec(context.Background(), "DELETE FROM banner WHERE id = "+id)
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tenantID := tenant.FromContext(ctx)
+
+	keys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.Exec(ctx,
+		`UPDATE banner SET deleted_at = NOW()
+		WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NULL;`, id, tenantID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -261,5 +577,622 @@ func (s *Repo) DeleteBanner(id string) error {
 		return storage.ErrBannerNotFound
 	}
 
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(tenantID, keys)
+
+	return nil
+}
+
+func (s *Repo) GetVersions(ctx context.Context, id int64) ([]models.BannerVersion, error) {
+	const op = "storage.postgres.GetVersions"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.DB.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM banner WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NULL);`, id, tenant.FromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, storage.ErrBannerNotFound
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			version,
+			tags,
+			feature,
+			content,
+			access,
+			active_from,
+			active_until,
+			updated_at
+		FROM bannerversion
+		WHERE bannerid = $1
+		ORDER BY version DESC;`, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	versions := make([]models.BannerVersion, 0)
+
+	for rows.Next() {
+		var version models.BannerVersion
+		err = rows.Scan(&version.Version, &version.Tag, &version.Feature, &version.Content, &version.Access,
+			&version.ActiveFrom, &version.ActiveUntil, &version.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		versions = append(versions, version)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return versions, nil
+}
+
+func (s *Repo) RestoreVersion(ctx context.Context, id, version int64) error {
+	const op = "storage.postgres.RestoreVersion"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tenantID := tenant.FromContext(ctx)
+
+	var v models.BannerVersion
+	err = tx.QueryRow(ctx,
+		`SELECT
+			tags,
+			feature,
+			content,
+			access,
+			active_from,
+			active_until
+		FROM bannerversion
+		WHERE bannerid = $1::bigint AND version = $2::bigint;`, id, version).Scan(&v.Tag, &v.Feature, &v.Content, &v.Access, &v.ActiveFrom, &v.ActiveUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrVersionNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.saveVersion(ctx, tx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrBannerNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	oldKeys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the feature or a tag of an old version may have been deleted since
+	tags := make([]int64, 0, len(v.Tag))
+	for _, tag := range v.Tag {
+		if tag != nil {
+			tags = append(tags, *tag)
+		}
+	}
+	err = checkReferences(ctx, tx, tenantID, v.Feature, tags)
+	if err != nil {
+		if errors.Is(err, storage.ErrReferenceNotFound) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE banner
+		SET feature = $2, content = $3, access = $4, active_from = $5, active_until = $6, updated_at = NOW()
+		WHERE id = $1 AND tenant_id = $7;`, id, v.Feature, v.Content, v.Access, v.ActiveFrom, v.ActiveUntil, tenantID)
+	if err != nil {
+		if scheduleViolated(err) {
+			return storage.ErrInvalidSchedule
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM bannertag WHERE bannerid = $1;`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO bannertag(bannerid, tagid) SELECT $1, unnest($2::int[]);`, id, v.Tag)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = checkContent(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrInvalidContent) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = checkConflicts(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrBannerConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	newKeys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	keys := mergeKeys(oldKeys, newKeys)
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		if pairTaken(err) {
+			return &storage.ConflictError{}
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(tenantID, keys)
+	return nil
+}
+
+// saveVersion locks the banner row, copies its current state into bannerversion
+// and drops the versions that fall out of the VersionLimit window.
+func (s *Repo) saveVersion(ctx context.Context, tx pgx.Tx, id int64) error {
+	var bannerID int64
+	err := tx.QueryRow(ctx,
+		`SELECT id FROM banner WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NULL FOR UPDATE;`, id, tenant.FromContext(ctx)).Scan(&bannerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrBannerNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO bannerversion(bannerid, version, feature, content, access, active_from, active_until, tags, updated_at)
+		SELECT
+			id,
+			COALESCE((SELECT MAX(version) FROM bannerversion WHERE bannerid = $1), 0) + 1,
+			feature,
+			content,
+			access,
+			active_from,
+			active_until,
+			ARRAY(SELECT tagid FROM bannertag WHERE bannerid = $1 ORDER BY tagid),
+			updated_at
+		FROM banner
+		WHERE id = $1;`, bannerID)
+	if err != nil || s.VersionLimit <= 0 {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM bannerversion
+		WHERE bannerid = $1 AND version <= (
+			SELECT MAX(version) FROM bannerversion WHERE bannerid = $1
+		) - $2;`, bannerID, s.VersionLimit)
 	return err
 }
+
+// checkReferences makes sure the feature and the tags exist and belong to
+// the tenant. A nil feature is not checked.
+func checkReferences(ctx context.Context, tx pgx.Tx, tenantID string, feature *int64, tags []int64) error {
+	var ok bool
+	err := tx.QueryRow(ctx,
+		`SELECT
+			($2::bigint IS NULL OR EXISTS(SELECT 1 FROM feature WHERE id = $2::bigint AND tenant_id = $1))
+			AND (SELECT COUNT(*) FROM tag WHERE id = ANY($3::bigint[]) AND tenant_id = $1)
+				= (SELECT COUNT(DISTINCT t) FROM unnest($3::bigint[]) AS t);`,
+		tenantID, feature, tags).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrReferenceNotFound
+	}
+	return nil
+}
+
+// scheduleViolated reports whether the write broke banner_active_window, e.g.
+// a PATCH of active_until alone that ends before the stored active_from.
+func scheduleViolated(err error) bool {
+	const checkViolation = "23514"
+
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == checkViolation &&
+		pgErr.ConstraintName == "banner_active_window"
+}
+
+// pairTaken reports whether COMMIT failed on the deferred
+// bannertag_feature_tagid_key: a concurrent writer that did not wait on the
+// same advisory lock took the feature and tag pair first.
+func pairTaken(err error) bool {
+	const uniqueViolation = "23505"
+
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation &&
+		pgErr.ConstraintName == "bannertag_feature_tagid_key"
+}
+
+// checkContent validates the written banner content and its variants against
+// the schema of its feature, if the feature has one.
+func checkContent(ctx context.Context, tx pgx.Tx, id int64) error {
+	var raw []byte
+	var content map[string]interface{}
+	err := tx.QueryRow(ctx,
+		`SELECT feature.content_schema, banner.content
+		FROM banner
+		INNER JOIN feature ON feature.id = banner.feature
+		WHERE banner.id = $1::bigint;`, id).Scan(&raw, &content)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	violations, err := schema.Validate(raw, content)
+	if err != nil {
+		return err
+	}
+	if len(raw) > 0 {
+		variants, err := variantViolations(ctx, tx, raw, id, nil)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, variants...)
+	}
+	if len(violations) > 0 {
+		return &storage.ContentError{Violations: violations}
+	}
+	return nil
+}
+
+// checkVariantContent validates the written variant content against the
+// schema of the banner feature. Users are served variant content instead of
+// the banner's own.
+func checkVariantContent(ctx context.Context, tx pgx.Tx, bannerID, variantID int64) error {
+	var raw []byte
+	err := tx.QueryRow(ctx,
+		`SELECT feature.content_schema
+		FROM banner
+		INNER JOIN feature ON feature.id = banner.feature
+		WHERE banner.id = $1::bigint;`, bannerID).Scan(&raw)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	violations, err := variantViolations(ctx, tx, raw, bannerID, &variantID)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &storage.ContentError{Violations: violations}
+	}
+	return nil
+}
+
+// variantViolations validates the variants of the banner, only variantID when
+// it is set. Otherwise the violations are marked with their variant.
+func variantViolations(ctx context.Context, tx pgx.Tx, raw []byte, bannerID int64, variantID *int64) ([]models.Violation, error) {
+	rows, err := tx.Query(ctx,
+		`SELECT id, content
+		FROM bannervariant
+		WHERE bannerid = $1::bigint AND ($2::bigint IS NULL OR id = $2::bigint)
+		ORDER BY id;`, bannerID, variantID)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Variant, error) {
+		var variant models.Variant
+		err := row.Scan(&variant.ID, &variant.Content)
+		return variant, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []models.Violation
+	for _, variant := range variants {
+		found, err := schema.Validate(raw, variant.Content)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; variantID == nil && i < len(found); i++ {
+			id := variant.ID
+			found[i].Variant = &id
+		}
+		violations = append(violations, found...)
+	}
+	return violations, nil
+}
+
+// checkConflicts looks for other banners owning the feature and tag pairs of
+// the written banner. Writers of the same feature wait for each other on an
+// advisory lock, so the check sees what the previous one committed; the
+// deferred unique constraint on bannertag is the backstop.
+func checkConflicts(ctx context.Context, tx pgx.Tx, id int64) error {
+	var feature *int64
+	err := tx.QueryRow(ctx, `SELECT feature FROM banner WHERE id = $1::bigint;`, id).Scan(&feature)
+	if err != nil {
+		return err
+	}
+	if feature == nil {
+		return nil
+	}
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('banner_feature'), $1::int);`, *feature)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT other.bannerid, other.feature, other.tagid
+		FROM bannertag own
+		INNER JOIN bannertag other ON other.feature = own.feature
+			AND other.tagid = own.tagid
+			AND other.bannerid <> own.bannerid
+		WHERE own.bannerid = $1::bigint
+		ORDER BY other.bannerid, other.tagid;`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var conflicts []models.BannerConflict
+	for rows.Next() {
+		var conflict models.BannerConflict
+		if err = rows.Scan(&conflict.BannerID, &conflict.FeatureID, &conflict.TagID); err != nil {
+			return err
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &storage.ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+func (s *Repo) CreateDeleteJob(ctx context.Context, feature, tag *int64) (int64, error) {
+	const op = "storage.postgres.CreateDeleteJob"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := s.DB.QueryRow(ctx,
+		`INSERT INTO job(tenant_id, feature, tag, status, total)
+		SELECT $4, $1, $2, $3, COUNT(*)
+		FROM banner
+		WHERE tenant_id = $4
+			AND deleted_at IS NULL
+			AND ($1::int IS NULL OR feature = $1)
+			AND ($2::int IS NULL OR id IN (SELECT bannerid FROM bannertag WHERE tagid = $2))
+		RETURNING id;`, feature, tag, models.JobPending, tenant.FromContext(ctx)).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Repo) GetJob(ctx context.Context, id int64) (*models.Job, error) {
+	const op = "storage.postgres.GetJob"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	job, err := s.scanJob(s.DB.QueryRow(ctx,
+		`SELECT id, tenant_id, feature, tag, status, total, deleted, error, created_at, updated_at, claim
+		FROM job
+		WHERE id = $1::bigint AND tenant_id = $2;`, id, tenant.FromContext(ctx)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrJobNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return job, nil
+}
+
+// NextJob claims the oldest pending job, or a running one whose lease expired,
+// for lease. Replicas skip the jobs claimed by others.
+func (s *Repo) NextJob(ctx context.Context, lease time.Duration) (*models.Job, error) {
+	const op = "storage.postgres.NextJob"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	job, err := s.scanJob(s.DB.QueryRow(ctx,
+		`UPDATE job
+		SET status = $2, claim = claim + 1, claimed_until = NOW() + $3 * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = (
+			SELECT id
+			FROM job
+			WHERE status = $1 OR (status = $2 AND (claimed_until IS NULL OR claimed_until < NOW()))
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, tenant_id, feature, tag, status, total, deleted, error, created_at, updated_at, claim;`,
+		models.JobPending, models.JobRunning, lease.Milliseconds()))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrJobNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return job, nil
+}
+
+// DeleteBannersBatch moves to the trash at most limit banners matching the job filter and
+// records the progress in the same transaction, so an interrupted job resumes
+// with correct counters. The batch extends the lease of the job and fails with
+// ErrJobClaimed when another replica took the job over.
+func (s *Repo) DeleteBannersBatch(ctx context.Context, job *models.Job, limit int, lease time.Duration) (int64, error) {
+	const op = "storage.postgres.DeleteBannersBatch"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT id
+		FROM banner
+		WHERE tenant_id = $4
+			AND deleted_at IS NULL
+			AND ($1::int IS NULL OR feature = $1)
+			AND ($2::int IS NULL OR id IN (SELECT bannerid FROM bannertag WHERE tagid = $2))
+		ORDER BY id
+		LIMIT $3
+		FOR UPDATE SKIP LOCKED;`, job.Feature, job.Tag, limit, job.Tenant)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := bannerKeys(ctx, tx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.Exec(ctx, `UPDATE banner SET deleted_at = NOW() WHERE id = ANY($1::bigint[]);`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	deleted := res.RowsAffected()
+
+	res, err = tx.Exec(ctx,
+		`UPDATE job
+		SET status = $2, deleted = deleted + $3, claimed_until = NOW() + $5 * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = $1 AND claim = $4;`, job.ID, models.JobRunning, deleted, job.Claim, lease.Milliseconds())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return 0, storage.ErrJobClaimed
+	}
+
+	if err = notifyChanges(ctx, tx, job.Tenant, keys); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(job.Tenant, keys)
+	job.Status = models.JobRunning
+	job.Deleted += deleted
+	return deleted, nil
+}
+
+// CountJobBanners counts the banners still matching the job filter, including
+// those a batch skipped because another transaction holds them.
+func (s *Repo) CountJobBanners(ctx context.Context, job *models.Job) (int64, error) {
+	const op = "storage.postgres.CountJobBanners"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var remaining int64
+	err := s.DB.QueryRow(ctx,
+		`SELECT COUNT(*)
+		FROM banner
+		WHERE tenant_id = $3
+			AND deleted_at IS NULL
+			AND ($1::int IS NULL OR feature = $1)
+			AND ($2::int IS NULL OR id IN (SELECT bannerid FROM bannertag WHERE tagid = $2));`,
+		job.Feature, job.Tag, job.Tenant).Scan(&remaining)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return remaining, nil
+}
+
+// ReleaseJob gives up the claim of an unfinished job, so the next replica
+// does not wait for the lease to expire.
+func (s *Repo) ReleaseJob(ctx context.Context, job *models.Job) error {
+	const op = "storage.postgres.ReleaseJob"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.DB.Exec(ctx,
+		`UPDATE job SET claimed_until = NULL WHERE id = $1 AND claim = $2;`, job.ID, job.Claim)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Repo) FinishJob(ctx context.Context, job *models.Job, jobErr error) error {
+	const op = "storage.postgres.FinishJob"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	status := models.JobDone
+	var msg *string
+	if jobErr != nil {
+		status = models.JobFailed
+		e := jobErr.Error()
+		msg = &e
+	}
+
+	res, err := s.DB.Exec(ctx,
+		`UPDATE job
+		SET status = $2, error = $3, claimed_until = NULL, updated_at = NOW()
+		WHERE id = $1 AND claim = $4;`, job.ID, status, msg, job.Claim)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrJobClaimed
+	}
+	return nil
+}
+
+func (s *Repo) scanJob(row pgx.Row) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(&job.ID, &job.Tenant, &job.Feature, &job.Tag, &job.Status, &job.Total, &job.Deleted, &job.Error, &job.Created, &job.Updated, &job.Claim)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
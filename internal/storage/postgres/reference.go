@@ -0,0 +1,247 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// The methods below take the table from models.ReferenceKind, never from the
+// request, so it is safe to put it into the query text.
+
+func (s *Repo) GetReferences(ctx context.Context, kind models.ReferenceKind, limit, offset int64) ([]models.Reference, error) {
+	const op = "storage.postgres.GetReferences"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT id, name, description
+		FROM `+string(kind)+`
+		WHERE tenant_id = $1
+		ORDER BY id
+		LIMIT $2::bigint OFFSET $3::bigint;`, tenant.FromContext(ctx), limitArg, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	references := make([]models.Reference, 0)
+	for rows.Next() {
+		var reference models.Reference
+		if err = rows.Scan(&reference.ID, &reference.Name, &reference.Description); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		references = append(references, reference)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return references, nil
+}
+
+func (s *Repo) GetReference(ctx context.Context, kind models.ReferenceKind, id int64) (*models.Reference, error) {
+	const op = "storage.postgres.GetReference"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var reference models.Reference
+	err := s.DB.QueryRow(ctx,
+		`SELECT id, name, description
+		FROM `+string(kind)+`
+		WHERE id = $1::bigint AND tenant_id = $2;`, id, tenant.FromContext(ctx)).
+		Scan(&reference.ID, &reference.Name, &reference.Description)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrReferenceNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &reference, nil
+}
+
+func (s *Repo) PostReference(ctx context.Context, kind models.ReferenceKind, reference *models.ReferencePost) (int64, error) {
+	const op = "storage.postgres.PostReference"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var id int64
+	err := s.DB.QueryRow(ctx,
+		`INSERT INTO `+string(kind)+`(tenant_id, name, description)
+		VALUES ($1, $2, $3)
+		RETURNING id;`, tenant.FromContext(ctx), reference.Name, reference.Description).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Repo) PatchReference(ctx context.Context, kind models.ReferenceKind, id int64, reference *models.ReferencePatch) error {
+	const op = "storage.postgres.PatchReference"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	args := []interface{}{id, tenant.FromContext(ctx)}
+	set := make([]string, 0, 2)
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		set = append(set, name+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if reference.Name.Defined {
+		column("name", reference.Name.Value)
+	}
+	if reference.Description.Defined {
+		column("description", reference.Description.Value)
+	}
+
+	if len(set) == 0 {
+		_, err := s.GetReference(ctx, kind, id)
+		return err
+	}
+
+	res, err := s.DB.Exec(ctx,
+		`UPDATE `+string(kind)+` SET `+strings.Join(set, ", ")+`
+		WHERE id = $1::bigint AND tenant_id = $2;`, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrReferenceNotFound
+	}
+	return nil
+}
+
+// DeleteReference refuses to delete a feature or tag that banners still use,
+// the foreign keys would silently detach them otherwise.
+func (s *Repo) DeleteReference(ctx context.Context, kind models.ReferenceKind, id int64) error {
+	const op = "storage.postgres.DeleteReference"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	used := `SELECT 1 FROM banner WHERE feature = $1::bigint`
+	if kind == models.KindTag {
+		used = `SELECT 1 FROM bannertag WHERE tagid = $1::bigint`
+	}
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var inUse bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS(`+used+`)
+		FROM `+string(kind)+`
+		WHERE id = $1::bigint AND tenant_id = $2
+		FOR UPDATE;`, id, tenant.FromContext(ctx)).Scan(&inUse)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return storage.ErrReferenceNotFound
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if inUse {
+		return storage.ErrReferenceInUse
+	}
+
+	_, err = tx.Exec(ctx,
+		`DELETE FROM `+string(kind)+` WHERE id = $1::bigint AND tenant_id = $2;`, id, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// GetFeatureSchema returns the content schema of the feature, nil when it has
+// none.
+func (s *Repo) GetFeatureSchema(ctx context.Context, id int64) (json.RawMessage, error) {
+	const op = "storage.postgres.GetFeatureSchema"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var raw []byte
+	err := s.DB.QueryRow(ctx,
+		`SELECT content_schema FROM feature WHERE id = $1::bigint AND tenant_id = $2;`,
+		id, tenant.FromContext(ctx)).Scan(&raw)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrReferenceNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return raw, nil
+}
+
+// SetFeatureSchema replaces the content schema of the feature, nil removes it.
+// Banners saved before are not checked again.
+func (s *Repo) SetFeatureSchema(ctx context.Context, id int64, contentSchema json.RawMessage) error {
+	const op = "storage.postgres.SetFeatureSchema"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var arg interface{}
+	if contentSchema != nil {
+		arg = string(contentSchema)
+	}
+
+	res, err := s.DB.Exec(ctx,
+		`UPDATE feature SET content_schema = $3::jsonb WHERE id = $1::bigint AND tenant_id = $2;`,
+		id, tenant.FromContext(ctx), arg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrReferenceNotFound
+	}
+	return nil
+}
+
+// createReferences inserts the given ids that do not exist yet for the
+// tenant. Ids taken by another tenant are left alone, checkReferences
+// reports them afterwards. The sequence is moved past the inserted ids so
+// that PostReference does not run into them later.
+func createReferences(ctx context.Context, tx pgx.Tx, kind models.ReferenceKind, tenantID string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO `+string(kind)+`(id, tenant_id)
+		SELECT DISTINCT unnest($1::int[]), $2
+		ON CONFLICT (id) DO NOTHING;`, ids, tenantID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`SELECT setval('`+string(kind)+`_id_seq', m)
+		FROM (SELECT MAX(id) AS m FROM unnest($1::int[]) AS id) AS ids, `+string(kind)+`_id_seq
+		WHERE m >= last_value;`, ids)
+	return err
+}
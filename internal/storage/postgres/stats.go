@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+)
+
+const dayLayout = "2006-01-02"
+
+// SaveStats adds the deltas to the daily counters. Deltas of banners that were
+// deleted in the meantime or belong to another tenant are dropped.
+func (s *Repo) SaveStats(ctx context.Context, deltas []models.StatsDelta) error {
+	const op = "storage.postgres.SaveStats"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tenants := make([]string, 0, len(deltas))
+	ids := make([]int64, 0, len(deltas))
+	days := make([]time.Time, 0, len(deltas))
+	impressions := make([]int64, 0, len(deltas))
+	clicks := make([]int64, 0, len(deltas))
+	for _, delta := range deltas {
+		tenants = append(tenants, delta.Tenant)
+		ids = append(ids, delta.BannerID)
+		days = append(days, delta.Day)
+		impressions = append(impressions, delta.Impressions)
+		clicks = append(clicks, delta.Clicks)
+	}
+
+	_, err := s.DB.Exec(ctx,
+		`INSERT INTO bannerstats (bannerid, day, impressions, clicks)
+		SELECT d.bannerid, d.day, d.impressions, d.clicks
+		FROM unnest($1::bigint[], $2::date[], $3::bigint[], $4::bigint[], $5::text[])
+			AS d(bannerid, day, impressions, clicks, tenant_id)
+		JOIN banner ON banner.id = d.bannerid AND banner.tenant_id = d.tenant_id
+		ON CONFLICT (bannerid, day) DO UPDATE SET
+			impressions = bannerstats.impressions + EXCLUDED.impressions,
+			clicks = bannerstats.clicks + EXCLUDED.clicks;`,
+		ids, days, impressions, clicks, tenants)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Repo) GetStats(ctx context.Context, id int64, from, to *time.Time) ([]models.BannerStats, error) {
+	const op = "storage.postgres.GetStats"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.DB.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM banner WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NULL);`, id, tenant.FromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, storage.ErrBannerNotFound
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			day,
+			impressions,
+			clicks
+		FROM bannerstats
+		WHERE bannerid = $1
+			AND ($2::date IS NULL OR day >= $2::date)
+			AND ($3::date IS NULL OR day <= $3::date)
+		ORDER BY day;`, id, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	stats := make([]models.BannerStats, 0)
+
+	for rows.Next() {
+		var (
+			day  time.Time
+			stat models.BannerStats
+		)
+		err = rows.Scan(&day, &stat.Impressions, &stat.Clicks)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		stat.Day = day.Format(dayLayout)
+		if stat.Impressions > 0 {
+			stat.CTR = float64(stat.Clicks) / float64(stat.Impressions)
+		}
+		stats = append(stats, stat)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return stats, nil
+}
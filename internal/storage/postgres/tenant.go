@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"sync"
+
+	"github.com/AnxVit/avito/internal/lib/tenant"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// tenantConns sets app.tenant, which the row level security policies check,
+// on every connection taken from the pool. The last value is remembered per
+// connection, so the extra round trip is paid only when the tenant changes.
+type tenantConns struct {
+	current sync.Map
+}
+
+func (t *tenantConns) beforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	id := tenant.FromContext(ctx)
+	if current, ok := t.current.Load(conn); ok && current == id {
+		return true
+	}
+	_, err := conn.Exec(ctx, `SELECT set_config('app.tenant', $1, false);`, id)
+	if err != nil {
+		t.current.Delete(conn)
+		return false
+	}
+	t.current.Store(conn, id)
+	return true
+}
+
+func (t *tenantConns) forget(conn *pgx.Conn) {
+	t.current.Delete(conn)
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Repo) GetTrash(ctx context.Context, limit, offset int64) ([]models.BannerDB, error) {
+	const op = "storage.postgres.GetTrash"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			id,
+			ARRAY(SELECT tagid FROM bannertag WHERE bannerid = banner.id ORDER BY tagid),
+			feature,
+			content,
+			access,
+			active_from,
+			active_until,
+			created_at,
+			updated_at,
+			deleted_at
+		FROM banner
+		WHERE tenant_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+		LIMIT $2::bigint OFFSET $3::bigint;`, tenant.FromContext(ctx), limitArg, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	banners := make([]models.BannerDB, 0)
+	for rows.Next() {
+		var banner models.BannerDB
+		err = rows.Scan(&banner.ID, &banner.Tag, &banner.Feature, &banner.Content, &banner.Access,
+			&banner.ActiveFrom, &banner.ActiveUntil, &banner.Created, &banner.Updated, &banner.Deleted)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		banners = append(banners, banner)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return banners, nil
+}
+
+// RestoreBanner takes a banner out of the trash. It fails with a conflict when
+// another banner has taken one of its feature and tag pairs meanwhile.
+func (s *Repo) RestoreBanner(ctx context.Context, id int64) error {
+	const op = "storage.postgres.RestoreBanner"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tenantID := tenant.FromContext(ctx)
+
+	res, err := tx.Exec(ctx,
+		`UPDATE banner SET deleted_at = NULL
+		WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NOT NULL;`, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrBannerNotFound
+	}
+
+	if err = checkConflicts(ctx, tx, id); err != nil {
+		if errors.Is(err, storage.ErrBannerConflict) {
+			return err
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := bannerKeys(ctx, tx, []int64{id})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		if pairTaken(err) {
+			return &storage.ConflictError{}
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	s.publish(tenantID, keys)
+	return nil
+}
+
+// TrashTenants returns the tenants having banners trashed before the given
+// time. trash_tenants reads bannertrash past row level security.
+func (s *Repo) TrashTenants(ctx context.Context, before time.Time) ([]string, error) {
+	const op = "storage.postgres.TrashTenants"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT trash_tenants($1);`, before)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	tenants, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return tenants, nil
+}
+
+// PurgeBanners permanently removes at most limit banners of the tenant from
+// ctx that were trashed before the given time. Users cannot reach trashed
+// banners, so there is nothing to evict from the caches.
+func (s *Repo) PurgeBanners(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.PurgeBanners"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	res, err := s.DB.Exec(ctx,
+		`DELETE FROM banner
+		WHERE id IN (
+			SELECT id
+			FROM banner
+			WHERE tenant_id = $1 AND deleted_at < $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		);`, tenant.FromContext(ctx), before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return res.RowsAffected(), nil
+}
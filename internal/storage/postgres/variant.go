@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Repo) GetVariants(ctx context.Context, bannerID int64) ([]models.Variant, error) {
+	const op = "storage.postgres.GetVariants"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var exists bool
+	err := s.DB.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM banner WHERE id = $1::bigint AND tenant_id = $2 AND deleted_at IS NULL);`, bannerID, tenant.FromContext(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return nil, storage.ErrBannerNotFound
+	}
+
+	rows, err := s.DB.Query(ctx,
+		`SELECT
+			id,
+			weight,
+			content,
+			created_at,
+			updated_at
+		FROM bannervariant
+		WHERE bannerid = $1
+		ORDER BY id;`, bannerID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	variants := make([]models.Variant, 0)
+
+	for rows.Next() {
+		var variant models.Variant
+		err = rows.Scan(&variant.ID, &variant.Weight, &variant.Content, &variant.Created, &variant.Updated)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		variants = append(variants, variant)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return variants, nil
+}
+
+func (s *Repo) PostVariant(ctx context.Context, bannerID int64, variant *models.VariantPost) (int64, error) {
+	const op = "storage.postgres.PostVariant"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var id int64
+	err = tx.QueryRow(ctx,
+		`INSERT INTO bannervariant(bannerid, content, weight)
+		SELECT id, $2, $3
+		FROM banner
+		WHERE id = $1::bigint AND tenant_id = $4 AND deleted_at IS NULL
+		RETURNING id;`, bannerID, variant.Content, variant.Weight, tenant.FromContext(ctx)).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, storage.ErrBannerNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = checkVariantContent(ctx, tx, bannerID, id); err != nil {
+		if errors.Is(err, storage.ErrInvalidContent) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err = s.commitChanges(ctx, tx, bannerID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return id, nil
+}
+
+func (s *Repo) PatchVariant(ctx context.Context, bannerID, variantID int64, variant *models.VariantPatch) error {
+	const op = "storage.postgres.PatchVariant"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	args := []interface{}{bannerID, variantID, tenant.FromContext(ctx)}
+	set := []string{"updated_at = NOW()"}
+	column := func(name string, value interface{}) {
+		args = append(args, value)
+		set = append(set, name+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if variant.Content.Defined {
+		column("content", variant.Content.Value)
+	}
+	if variant.Weight.Defined {
+		column("weight", variant.Weight.Value)
+	}
+
+	res, err := tx.Exec(ctx,
+		`UPDATE bannervariant SET `+strings.Join(set, ", ")+`
+		WHERE bannerid = $1::bigint AND id = $2::bigint
+			AND bannerid IN (SELECT id FROM banner WHERE tenant_id = $3 AND deleted_at IS NULL);`, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrVariantNotFound
+	}
+
+	if variant.Content.Defined {
+		if err = checkVariantContent(ctx, tx, bannerID, variantID); err != nil {
+			if errors.Is(err, storage.ErrInvalidContent) {
+				return err
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err = s.commitChanges(ctx, tx, bannerID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (s *Repo) DeleteVariant(ctx context.Context, bannerID, variantID int64) error {
+	const op = "storage.postgres.DeleteVariant"
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := s.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	res, err := tx.Exec(ctx,
+		`DELETE FROM bannervariant
+		WHERE bannerid = $1::bigint AND id = $2::bigint
+			AND bannerid IN (SELECT id FROM banner WHERE tenant_id = $3 AND deleted_at IS NULL);`, bannerID, variantID, tenant.FromContext(ctx))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if res.RowsAffected() == 0 {
+		return storage.ErrVariantNotFound
+	}
+
+	if err = s.commitChanges(ctx, tx, bannerID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+// commitChanges commits a write that changes what users of the banner see
+// and evicts the banner keys everywhere.
+func (s *Repo) commitChanges(ctx context.Context, tx pgx.Tx, bannerID int64) error {
+	keys, err := bannerKeys(ctx, tx, []int64{bannerID})
+	if err != nil {
+		return err
+	}
+	tenantID := tenant.FromContext(ctx)
+	if err = notifyChanges(ctx, tx, tenantID, keys); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.publish(tenantID, keys)
+	return nil
+}
@@ -1,10 +1,60 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+)
 
 var (
-	ErrUserNotFound   = errors.New("user not found")
-	ErrUserExists     = errors.New("user already exists")
-	ErrNotAccess      = errors.New("user don't have access")
-	ErrBannerNotFound = errors.New("banner not found")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserExists        = errors.New("user already exists")
+	ErrNotAccess         = errors.New("user don't have access")
+	ErrBannerNotFound    = errors.New("banner not found")
+	ErrVersionNotFound   = errors.New("banner version not found")
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobClaimed        = errors.New("job is claimed by another worker")
+	ErrVariantNotFound   = errors.New("banner variant not found")
+	ErrReferenceNotFound = errors.New("feature or tag not found")
+	ErrBannerConflict    = errors.New("banner for feature and tag already exists")
+	ErrReferenceInUse    = errors.New("feature or tag is used by banners")
+	ErrInvalidContent    = errors.New("banner content does not match the feature schema")
+	ErrInvalidSchedule   = errors.New("active_until must be after active_from")
 )
+
+// ConflictError lists the banners that already own the feature and tag pairs
+// a write tried to take. It matches ErrBannerConflict. Conflicts is empty when
+// the pair was taken by a concurrent write noticed only at commit.
+type ConflictError struct {
+	Conflicts []models.BannerConflict
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Conflicts) == 0 {
+		return ErrBannerConflict.Error()
+	}
+	ids := make([]int64, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		ids = append(ids, c.BannerID)
+	}
+	return fmt.Sprintf("%s: banners %v", ErrBannerConflict, ids)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrBannerConflict
+}
+
+// ContentError lists the places where the banner content breaks the schema of
+// its feature. It matches ErrInvalidContent.
+type ContentError struct {
+	Violations []models.Violation
+}
+
+func (e *ContentError) Error() string {
+	return fmt.Sprintf("%s: %d violations", ErrInvalidContent, len(e.Violations))
+}
+
+func (e *ContentError) Is(target error) bool {
+	return target == ErrInvalidContent
+}
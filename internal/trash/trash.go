@@ -0,0 +1,111 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+)
+
+type Repository interface {
+	TrashTenants(ctx context.Context, before time.Time) ([]string, error)
+	PurgeBanners(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Purger permanently removes the banners that stayed in the trash longer than
+// the retention period.
+type Purger struct {
+	DB  Repository
+	log *slog.Logger
+	cfg config.Trash
+	now func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func New(cfg *config.Trash, db Repository, log *slog.Logger) *Purger {
+	return &Purger{
+		DB:   db,
+		log:  log,
+		cfg:  *cfg,
+		now:  time.Now,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (p *Purger) Start() {
+	go p.run()
+}
+
+// Stop waits for the current batch to finish.
+func (p *Purger) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+// Purge removes the expired banners of all tenants in batches of BatchSize and
+// returns how many were removed.
+func (p *Purger) Purge(ctx context.Context) (int64, error) {
+	before := p.now().Add(-p.cfg.Retention)
+
+	tenants, err := p.DB.TrashTenants(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	var errs []error
+	for _, tenantID := range tenants {
+		tenantCtx := tenant.With(ctx, tenantID)
+		for {
+			select {
+			case <-p.stop:
+				return purged, errors.Join(errs...)
+			default:
+			}
+
+			n, err := p.DB.PurgeBanners(tenantCtx, before, p.cfg.BatchSize)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+			purged += n
+			// a short batch is the last one, an empty one also stops a zero BatchSize
+			if n == 0 || n < int64(p.cfg.BatchSize) {
+				break
+			}
+		}
+	}
+	return purged, errors.Join(errs...)
+}
+
+func (p *Purger) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge() {
+	purged, err := p.Purge(context.Background())
+	if err != nil {
+		p.log.Error("failed to purge trash", slog.String("error", err.Error()))
+	}
+	if purged > 0 {
+		p.log.Info("trash purged", slog.Int64("banners", purged))
+	}
+}
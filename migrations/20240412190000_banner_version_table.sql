@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS bannerVersion(
+    BannerID INT REFERENCES banner ON DELETE CASCADE,
+    Version INT NOT NULL,
+    feature INT,
+    content JSONB,
+    access BOOLEAN,
+    tags INT[],
+    updated_at TIMESTAMPTZ,
+    PRIMARY KEY(BannerID, Version)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bannerVersion;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE banner
+    ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS active_until TIMESTAMPTZ,
+    ADD CONSTRAINT banner_active_window
+        CHECK (active_from IS NULL OR active_until IS NULL OR active_from < active_until);
+
+ALTER TABLE bannerVersion
+    ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS active_until TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE bannerVersion
+    DROP COLUMN IF EXISTS active_from,
+    DROP COLUMN IF EXISTS active_until;
+
+ALTER TABLE banner
+    DROP COLUMN IF EXISTS active_from,
+    DROP COLUMN IF EXISTS active_until;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS job(
+    id INT GENERATED ALWAYS AS IDENTITY,
+    feature INT,
+    tag INT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    total INT NOT NULL DEFAULT 0,
+    deleted INT NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS job;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS bannerVariant(
+    id INT GENERATED ALWAYS AS IDENTITY,
+    BannerID INT NOT NULL REFERENCES banner ON DELETE CASCADE,
+    content JSONB NOT NULL,
+    weight INT NOT NULL CHECK(0 < weight),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(id)
+);
+
+CREATE INDEX IF NOT EXISTS bannerVariant_BannerID_idx ON bannerVariant(BannerID);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS bannerVariant;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE feature ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE tag ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE banner ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE job ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS banner_tenant_id_feature_idx ON banner(tenant_id, feature);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- app.tenant is set by the service for every connection it takes from the pool
+ALTER TABLE feature ENABLE ROW LEVEL SECURITY;
+ALTER TABLE feature FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON feature
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE tag ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tag FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON tag
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE banner ENABLE ROW LEVEL SECURITY;
+ALTER TABLE banner FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON banner
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP POLICY IF EXISTS tenant_isolation ON banner;
+ALTER TABLE banner NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE banner DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON tag;
+ALTER TABLE tag NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE tag DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON feature;
+ALTER TABLE feature NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE feature DISABLE ROW LEVEL SECURITY;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX IF EXISTS banner_tenant_id_feature_idx;
+
+ALTER TABLE job DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE banner DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE tag DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE feature DROP COLUMN IF EXISTS tenant_id;
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- +goose Up
+-- +goose StatementBegin
+-- bannerTag keeps a copy of the banner feature so that a feature and tag pair
+-- can be made unique. Existing duplicates have to be resolved before the upgrade.
+ALTER TABLE bannerTag ADD COLUMN IF NOT EXISTS feature INT;
+
+UPDATE bannerTag SET feature = banner.feature
+FROM banner
+WHERE banner.id = bannerTag.BannerID;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION banner_tag_feature() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.feature := (SELECT feature FROM banner WHERE id = NEW.BannerID);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION banner_feature_changed() RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE bannerTag SET feature = NEW.feature WHERE BannerID = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER banner_tag_feature
+    BEFORE INSERT OR UPDATE OF BannerID ON bannerTag
+    FOR EACH ROW EXECUTE FUNCTION banner_tag_feature();
+
+CREATE TRIGGER banner_feature_changed
+    AFTER UPDATE OF feature ON banner
+    FOR EACH ROW WHEN (OLD.feature IS DISTINCT FROM NEW.feature)
+    EXECUTE FUNCTION banner_feature_changed();
+
+-- deferred: a patch moves the feature and the tags in separate statements
+ALTER TABLE bannerTag ADD CONSTRAINT bannertag_feature_tagid_key
+    UNIQUE (feature, TagID) DEFERRABLE INITIALLY DEFERRED;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE bannerTag DROP CONSTRAINT IF EXISTS bannertag_feature_tagid_key;
+
+DROP TRIGGER IF EXISTS banner_feature_changed ON banner;
+DROP TRIGGER IF EXISTS banner_tag_feature ON bannerTag;
+DROP FUNCTION IF EXISTS banner_feature_changed();
+DROP FUNCTION IF EXISTS banner_tag_feature();
+
+ALTER TABLE bannerTag DROP COLUMN IF EXISTS feature;
+-- +goose StatementEnd
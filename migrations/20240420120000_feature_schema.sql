@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE feature ADD COLUMN IF NOT EXISTS content_schema JSONB;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE feature DROP COLUMN IF EXISTS content_schema;
+-- +goose StatementEnd
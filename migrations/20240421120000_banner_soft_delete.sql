@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE banner ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- bannerTrash lists the trashed banners of all tenants for the purger, banner
+-- itself is only visible per tenant.
+CREATE TABLE IF NOT EXISTS bannerTrash (
+    BannerID INT PRIMARY KEY REFERENCES banner(id) ON DELETE CASCADE,
+    tenant_id TEXT NOT NULL,
+    deleted_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS bannertrash_deleted_at_idx ON bannerTrash(deleted_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- A trashed banner gives up its feature and tag pairs, so that a new banner
+-- can take them; restoring takes them back.
+CREATE OR REPLACE FUNCTION banner_trashed() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.deleted_at IS NULL THEN
+        DELETE FROM bannerTrash WHERE BannerID = NEW.id;
+        UPDATE bannerTag SET feature = NEW.feature WHERE BannerID = NEW.id;
+    ELSE
+        INSERT INTO bannerTrash(BannerID, tenant_id, deleted_at)
+        VALUES (NEW.id, NEW.tenant_id, NEW.deleted_at)
+        ON CONFLICT (BannerID) DO UPDATE SET deleted_at = EXCLUDED.deleted_at;
+        UPDATE bannerTag SET feature = NULL WHERE BannerID = NEW.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER banner_trashed
+    AFTER UPDATE OF deleted_at ON banner
+    FOR EACH ROW WHEN (OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+    EXECUTE FUNCTION banner_trashed();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS banner_trashed ON banner;
+DROP FUNCTION IF EXISTS banner_trashed();
+
+DROP TABLE IF EXISTS bannerTrash;
+
+DELETE FROM banner WHERE deleted_at IS NOT NULL;
+ALTER TABLE banner DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
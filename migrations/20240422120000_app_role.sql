@@ -0,0 +1,46 @@
+-- +goose Up
+-- The service connects as this role. It is neither a superuser nor BYPASSRLS,
+-- otherwise Postgres skips the tenant_isolation policies. The migrator passes
+-- its name and password in PG_APP_USER and PG_APP_PASSWORD.
+-- +goose StatementBegin
+DO $$
+-- +goose ENVSUB ON
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = '${PG_APP_USER:-banner_app}') THEN
+        CREATE ROLE "${PG_APP_USER:-banner_app}" LOGIN NOSUPERUSER NOBYPASSRLS NOCREATEDB NOCREATEROLE
+            PASSWORD '${PG_APP_PASSWORD:-banner_app}';
+    END IF;
+END
+-- +goose ENVSUB OFF
+$$;
+-- +goose StatementEnd
+
+-- UPDATE on the sequences lets create_missing move them past the ids it inserts.
+-- +goose ENVSUB ON
+-- +goose StatementBegin
+GRANT USAGE ON SCHEMA public TO "${PG_APP_USER:-banner_app}";
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "${PG_APP_USER:-banner_app}";
+GRANT USAGE, SELECT, UPDATE ON ALL SEQUENCES IN SCHEMA public TO "${PG_APP_USER:-banner_app}";
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "${PG_APP_USER:-banner_app}";
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    GRANT USAGE, SELECT, UPDATE ON SEQUENCES TO "${PG_APP_USER:-banner_app}";
+-- +goose StatementEnd
+-- +goose ENVSUB OFF
+
+-- +goose Down
+-- +goose ENVSUB ON
+-- +goose StatementBegin
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    REVOKE USAGE, SELECT, UPDATE ON SEQUENCES FROM "${PG_APP_USER:-banner_app}";
+ALTER DEFAULT PRIVILEGES IN SCHEMA public
+    REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM "${PG_APP_USER:-banner_app}";
+
+REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM "${PG_APP_USER:-banner_app}";
+REVOKE ALL ON ALL TABLES IN SCHEMA public FROM "${PG_APP_USER:-banner_app}";
+REVOKE USAGE ON SCHEMA public FROM "${PG_APP_USER:-banner_app}";
+
+DROP ROLE IF EXISTS "${PG_APP_USER:-banner_app}";
+-- +goose StatementEnd
+-- +goose ENVSUB OFF
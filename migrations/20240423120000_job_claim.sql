@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A replica claims a job until claimed_until and extends the lease with every
+-- batch. claim grows with every claim, so a replica that lost its lease cannot
+-- write to the job anymore.
+ALTER TABLE job
+    ADD COLUMN IF NOT EXISTS claim BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS job_unfinished_idx ON job(id) WHERE status IN ('pending', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS job_unfinished_idx;
+
+ALTER TABLE job
+    DROP COLUMN IF EXISTS claimed_until,
+    DROP COLUMN IF EXISTS claim;
+-- +goose StatementEnd
@@ -0,0 +1,123 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The tables hanging off banner get their own tenant_id, so that row level
+-- security isolates them without a join through banner. The trigger copies it
+-- from the banner, which the writer sees only in its own tenant: a row of a
+-- foreign banner gets no tenant and is refused by NOT NULL. The default is for
+-- loads that run with triggers disabled.
+ALTER TABLE bannerTag ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE bannerVersion ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE bannerVariant ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE bannerStats ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+
+UPDATE bannerTag SET tenant_id = banner.tenant_id FROM banner WHERE banner.id = bannerTag.BannerID;
+UPDATE bannerVersion SET tenant_id = banner.tenant_id FROM banner WHERE banner.id = bannerVersion.BannerID;
+UPDATE bannerVariant SET tenant_id = banner.tenant_id FROM banner WHERE banner.id = bannerVariant.BannerID;
+UPDATE bannerStats SET tenant_id = banner.tenant_id FROM banner WHERE banner.id = bannerStats.BannerID;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION banner_child_tenant() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.tenant_id := (SELECT tenant_id FROM banner WHERE id = NEW.BannerID);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER banner_child_tenant
+    BEFORE INSERT OR UPDATE OF BannerID ON bannerTag
+    FOR EACH ROW EXECUTE FUNCTION banner_child_tenant();
+
+CREATE TRIGGER banner_child_tenant
+    BEFORE INSERT OR UPDATE OF BannerID ON bannerVersion
+    FOR EACH ROW EXECUTE FUNCTION banner_child_tenant();
+
+CREATE TRIGGER banner_child_tenant
+    BEFORE INSERT OR UPDATE OF BannerID ON bannerVariant
+    FOR EACH ROW EXECUTE FUNCTION banner_child_tenant();
+
+CREATE TRIGGER banner_child_tenant
+    BEFORE INSERT OR UPDATE OF BannerID ON bannerStats
+    FOR EACH ROW EXECUTE FUNCTION banner_child_tenant();
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE bannerTag ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bannerTag FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON bannerTag
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE bannerVersion ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bannerVersion FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON bannerVersion
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE bannerVariant ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bannerVariant FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON bannerVariant
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE bannerStats ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bannerStats FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON bannerStats
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+
+ALTER TABLE bannerTrash ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bannerTrash FORCE ROW LEVEL SECURITY;
+CREATE POLICY tenant_isolation ON bannerTrash
+    USING (tenant_id = current_setting('app.tenant', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant', true));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- The purger has to find the tenants with expired trash before it can work in
+-- any of them. The function runs as its owner, the migration role, and returns
+-- nothing but the tenant ids.
+CREATE OR REPLACE FUNCTION trash_tenants(before TIMESTAMPTZ) RETURNS SETOF TEXT AS $$
+    SELECT DISTINCT tenant_id FROM bannerTrash WHERE deleted_at < before ORDER BY tenant_id;
+$$ LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP FUNCTION IF EXISTS trash_tenants(TIMESTAMPTZ);
+
+DROP POLICY IF EXISTS tenant_isolation ON bannerTrash;
+ALTER TABLE bannerTrash NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE bannerTrash DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON bannerStats;
+ALTER TABLE bannerStats NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE bannerStats DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON bannerVariant;
+ALTER TABLE bannerVariant NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE bannerVariant DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON bannerVersion;
+ALTER TABLE bannerVersion NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE bannerVersion DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON bannerTag;
+ALTER TABLE bannerTag NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE bannerTag DISABLE ROW LEVEL SECURITY;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TRIGGER IF EXISTS banner_child_tenant ON bannerStats;
+DROP TRIGGER IF EXISTS banner_child_tenant ON bannerVariant;
+DROP TRIGGER IF EXISTS banner_child_tenant ON bannerVersion;
+DROP TRIGGER IF EXISTS banner_child_tenant ON bannerTag;
+DROP FUNCTION IF EXISTS banner_child_tenant();
+
+ALTER TABLE bannerStats DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE bannerVariant DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE bannerVersion DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE bannerTag DROP COLUMN IF EXISTS tenant_id;
+-- +goose StatementEnd
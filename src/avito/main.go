@@ -1,13 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
 	"github.com/AnxVit/avito/internal/http-server/server"
+	"github.com/AnxVit/avito/internal/jobs"
+	"github.com/AnxVit/avito/internal/metrics"
+	"github.com/AnxVit/avito/internal/stats"
 	"github.com/AnxVit/avito/internal/storage/cache"
 	"github.com/AnxVit/avito/internal/storage/postgres"
+	"github.com/AnxVit/avito/internal/tracing"
+	"github.com/AnxVit/avito/internal/trash"
 )
 
 const (
@@ -22,23 +33,94 @@ func main() {
 	log := setupLogger(cfg.Env)
 	log.Info("starting auth-reg server", slog.String("env", cfg.Env))
 
+	shutdownTracing, err := tracing.Setup(context.Background(), &cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", slog.String("error", err.Error()))
+		os.Exit(4)
+	}
+
 	repo, err := postgres.New(&cfg.DB)
 	if err != nil {
 		log.Error("failed to init db")
 		os.Exit(1)
 	}
-	localcache, err := cache.New(repo)
+	localcache, err := cache.New(&cfg.Cache, repo)
 	if err != nil {
 		log.Error("failed to init cache")
 		os.Exit(2)
 	}
+	m := metrics.New(&cfg.Metrics)
+	m.RegisterPool(repo.DB.Stat)
+	localcache.Metrics = m
+	localcache.Notifier = repo
+
+	repo.Subscribe(localcache.Evict)
+	repo.SubscribePurge(localcache.EvictMatching)
+	warmer := cache.NewWarmer(&cfg.Cache.Warmup, localcache, log)
+	listenCtx, stopListen := context.WithCancel(context.Background())
+	listenDone := make(chan struct{})
+	go func() {
+		defer close(listenDone)
+		_ = repo.Listen(listenCtx)
+	}()
+
+	verifier, err := auth.New(&cfg.Auth)
+	if err != nil {
+		log.Error("failed to init auth", slog.String("error", err.Error()))
+		os.Exit(3)
+	}
+
+	runner := jobs.New(&cfg.Jobs, repo, log)
+	runner.Start()
+
+	recorder := stats.New(&cfg.Stats, repo, log)
+	recorder.Start()
 
-	srv := server.New(&cfg.Server, repo, localcache, log)
-	if err := srv.Serve(); err != nil {
-		log.Error("failed to start server")
+	purger := trash.New(&cfg.Trash, repo, log)
+	purger.Start()
+
+	srv := server.New(&cfg.Server, repo, localcache, runner, recorder, verifier, m, log)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve()
+	}()
+
+	// /readyz answers 503 until the first snapshot is loaded
+	warmer.Start()
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", slog.String("error", err.Error()))
+		}
+	case <-ctx.Done():
+		log.Info("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Error("failed to shutdown server", slog.String("error", err.Error()))
+		}
+		cancel()
+	}
+
+	warmer.Stop()
+	runner.Stop()
+	recorder.Stop()
+	purger.Stop()
+	stopListen()
+	<-listenDone
+	if err := localcache.Close(); err != nil {
+		log.Error("failed to close cache", slog.String("error", err.Error()))
+	}
+	repo.Close()
+	if err := shutdownTracing(context.Background()); err != nil {
+		log.Error("failed to flush spans", slog.String("error", err.Error()))
 	}
 
-	log.Error("server stoped")
+	log.Info("server stopped")
 }
 
 func setupLogger(env string) *slog.Logger {
@@ -24,7 +24,7 @@ var (
 )
 
 func GetDNS(c *config.DB) string {
-	return fmt.Sprintf(fmtDBString, c.Host, c.User, c.Password, c.DBName, c.Port)
+	return fmt.Sprintf(fmtDBString, c.Host, c.MigrateUser, c.MigratePassword, c.DBName, c.Port)
 }
 
 func main() {
@@ -37,6 +37,10 @@ func main() {
 	cfg := config.MustLoad()
 	c := cfg.DB
 
+	// the app role migration creates the service role from these
+	os.Setenv("PG_APP_USER", c.User)
+	os.Setenv("PG_APP_PASSWORD", c.Password)
+
 	dbString := GetDNS(&c)
 
 	db, err := goose.OpenDBWithDriver(dialect, dbString)
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/handlers/admin"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func fillCache(t *testing.T, c *cache.Cache, keys ...[2]int) {
+	t.Helper()
+	for _, key := range keys {
+		_, err := c.GetUserBanner(context.Background(), key[0], key[1], false, false)
+		require.NoError(t, err)
+	}
+}
+
+func TestCacheInspect(t *testing.T) {
+	for _, backend := range []string{cache.BackendMemory, cache.BackendRedis} {
+		t.Run(backend, func(t *testing.T) {
+			cfg := &config.Cache{
+				Backend:   backend,
+				TTL:       time.Minute,
+				KeyFormat: "banner:%d:%d",
+				Codec:     cache.CodecJSON,
+			}
+			if backend == cache.BackendRedis {
+				cfg.Redis = config.Redis{Addr: miniredis.RunT(t).Addr()}
+			}
+			repo := newCountingRepo()
+			repo.banner.ID = 7
+			c, err := cache.New(cfg, repo)
+			require.NoError(t, err)
+			defer c.Close()
+
+			fillCache(t, c, [2]int{2, 1}, [2]int{1, 2}, [2]int{1, 1}, [2]int{1, 1})
+			_, err = c.GetUserBanner(tenant.With(context.Background(), "acme"), 1, 1, false, false)
+			require.NoError(t, err)
+
+			stats, err := c.Inspect(context.Background(), 2)
+			require.NoError(t, err)
+			require.Equal(t, 3, stats.Size)
+			// the acme request counts only for acme
+			require.Equal(t, uint64(1), stats.Hits)
+			require.Equal(t, uint64(3), stats.Misses)
+			require.InDelta(t, 0.25, stats.HitRatio, 1e-9)
+			require.Len(t, stats.Keys, 2)
+			require.Equal(t, [2]int{1, 1}, [2]int{stats.Keys[0].Tag, stats.Keys[0].Feature})
+			require.Equal(t, [2]int{1, 2}, [2]int{stats.Keys[1].Tag, stats.Keys[1].Feature})
+			require.Equal(t, int64(7), *stats.Keys[0].BannerID)
+			require.False(t, stats.Keys[0].Stale)
+			require.WithinDuration(t, time.Now().Add(time.Minute), stats.Keys[0].ExpiresAt, 5*time.Second)
+			require.Nil(t, stats.Keys[0].Content)
+
+			entry, err := c.InspectKey(context.Background(), 1, 2)
+			require.NoError(t, err)
+			require.Equal(t, "sky", entry.Content["title"])
+
+			_, err = c.InspectKey(context.Background(), 3, 3)
+			require.ErrorIs(t, err, cache.ErrNotCached)
+
+			tag := 1
+			purged, err := c.Purge(context.Background(), &tag, nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, purged)
+
+			stats, err = c.Inspect(context.Background(), 0)
+			require.NoError(t, err)
+			require.Equal(t, 1, stats.Size)
+			require.Equal(t, 2, stats.Keys[0].Tag)
+
+			// other tenants keep their keys
+			stats, err = c.Inspect(tenant.With(context.Background(), "acme"), 0)
+			require.NoError(t, err)
+			require.Equal(t, 1, stats.Size)
+			require.Zero(t, stats.Hits)
+			require.Equal(t, uint64(1), stats.Misses)
+
+			purged, err = c.Purge(context.Background(), nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, 1, purged)
+
+			fillCache(t, c, [2]int{2, 1})
+			require.Equal(t, int64(5), repo.calls.Load())
+		})
+	}
+}
+
+type purgeNotifier struct {
+	tag, feature *int
+	calls        int
+	err          error
+}
+
+func (n *purgeNotifier) NotifyPurge(_ context.Context, tag, feature *int) error {
+	n.tag, n.feature = tag, feature
+	n.calls++
+	return n.err
+}
+
+func TestCachePurgeNotifies(t *testing.T) {
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, newCountingRepo())
+	require.NoError(t, err)
+	notifier := &purgeNotifier{}
+	c.Notifier = notifier
+	fillCache(t, c, [2]int{1, 1}, [2]int{1, 2}, [2]int{2, 2})
+
+	feature := 2
+	purged, err := c.Purge(context.Background(), nil, &feature)
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+	require.Nil(t, notifier.tag)
+	require.Equal(t, &feature, notifier.feature)
+
+	// the local purge stands when the broadcast fails
+	notifier.err = errors.New("connection refused")
+	purged, err = c.Purge(context.Background(), nil, nil)
+	require.ErrorIs(t, err, cache.ErrNotBroadcast)
+	require.ErrorIs(t, err, notifier.err)
+	require.Equal(t, 1, purged)
+	stats, err := c.Inspect(context.Background(), 0)
+	require.NoError(t, err)
+	require.Zero(t, stats.Size)
+}
+
+func TestCacheEvictMatching(t *testing.T) {
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, newCountingRepo())
+	require.NoError(t, err)
+	acme := tenant.With(context.Background(), "acme")
+	fillCache(t, c, [2]int{1, 1}, [2]int{1, 2}, [2]int{2, 2})
+	_, err = c.GetUserBanner(acme, 1, 1, false, false)
+	require.NoError(t, err)
+
+	tag := 1
+	c.EvictMatching(tenant.FromContext(context.Background()), &tag, nil)
+
+	stats, err := c.Inspect(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Size)
+	require.Equal(t, [2]int{2, 2}, [2]int{stats.Keys[0].Tag, stats.Keys[0].Feature})
+	stats, err = c.Inspect(acme, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Size)
+}
+
+func TestAdminCacheHandlers(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+	fillCache(t, c, [2]int{1, 1}, [2]int{1, 2}, [2]int{2, 2})
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router := chi.NewRouter()
+	router.Get("/admin/cache", admin.NewGetCache(log, c, 100))
+	router.Get("/admin/cache/{tag}/{feature}", admin.NewGetCacheKey(log, c))
+	router.Delete("/admin/cache", admin.NewPurgeCache(log, c))
+
+	do := func(method, target string, permission access.Access) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), auth.UserContextKey, access.Principal{Subject: "test", Access: permission})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, nil).WithContext(ctx))
+		return rec
+	}
+
+	for _, target := range []string{"/admin/cache", "/admin/cache/1/1"} {
+		require.Equal(t, http.StatusForbidden, do("GET", target, access.User).Code)
+		require.Equal(t, http.StatusUnauthorized, do("GET", target, access.NotAccess).Code)
+	}
+	require.Equal(t, http.StatusForbidden, do("DELETE", "/admin/cache", access.User).Code)
+
+	rec := do("GET", "/admin/cache?limit=1", access.Admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var stats models.CacheStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	require.Equal(t, 3, stats.Size)
+	require.Len(t, stats.Keys, 1)
+
+	require.Equal(t, http.StatusBadRequest, do("GET", "/admin/cache?limit=x", access.Admin).Code)
+	require.Equal(t, http.StatusBadRequest, do("GET", "/admin/cache/x/1", access.Admin).Code)
+	require.Equal(t, http.StatusNotFound, do("GET", "/admin/cache/3/3", access.Admin).Code)
+
+	rec = do("GET", "/admin/cache/1/2", access.Admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var entry models.CacheEntry
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entry))
+	require.Equal(t, 2, entry.Feature)
+	require.Equal(t, "sky", entry.Content["title"])
+
+	require.Equal(t, http.StatusBadRequest, do("DELETE", "/admin/cache?tag_id=0", access.Admin).Code)
+
+	rec = do("DELETE", "/admin/cache?feature_id=2", access.Admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"purged":2}`, rec.Body.String())
+
+	c.Notifier = &purgeNotifier{err: errors.New("connection refused")}
+	rec = do("DELETE", "/admin/cache", access.Admin)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.JSONEq(t, `{"purged":1,"error":"other instances are not purged"}`, rec.Body.String())
+}
@@ -2,8 +2,12 @@ package test
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"database/sql"
 	"encoding/json"
+	"encoding/pem"
 	"io"
 	"log/slog"
 	"net/http"
@@ -12,26 +16,54 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/AnxVit/avito/internal/config"
 	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/http-server/handlers/banner"
+	userbanner "github.com/AnxVit/avito/internal/http-server/handlers/user_banner"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
 	"github.com/AnxVit/avito/internal/http-server/server"
+	"github.com/AnxVit/avito/internal/jobs"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/metrics"
+	"github.com/AnxVit/avito/internal/stats"
+	"github.com/AnxVit/avito/internal/storage"
 	"github.com/AnxVit/avito/internal/storage/cache"
 	"github.com/AnxVit/avito/internal/storage/postgres"
+	"github.com/AnxVit/avito/internal/trash"
 	pgcontainer "github.com/AnxVit/avito/tests/container/postgres"
 
 	"github.com/AnxVit/avito/tests/migrate"
 
 	"github.com/go-testfixtures/testfixtures/v3"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/suite"
 )
 
+const (
+	authSecret   = "test_secret"
+	authIssuer   = "avito"
+	authAudience = "banner"
+)
+
 type TestSuite struct {
 	suite.Suite
 	psqlContainer *pgcontainer.PostgresContainer
 	server        *httptest.Server
+	runner        *jobs.Runner
+	recorder      *stats.Recorder
+	repo          *postgres.Repo
+	cfgDB         *config.DB
+	stopListen    context.CancelFunc
+	privateKey    *rsa.PrivateKey
+	userToken     string
+	adminToken    string
 }
 
 func (s *TestSuite) SetupSuite() {
@@ -48,28 +80,85 @@ func (s *TestSuite) SetupSuite() {
 
 	port, _ := strconv.Atoi(psqlContainer.Port)
 	cfgDB := &config.DB{
-		User:     "postgres",
-		Password: "1234",
+		User:     pgcontainer.AppUser,
+		Password: pgcontainer.AppPassword,
 		Host:     psqlContainer.Host,
 		Port:     port,
 		DBName:   "test_banner",
+
+		VersionLimit: 3,
 	}
 	cfgServer := &config.Server{
 		Host:    "localhost",
 		Port:    "8082",
 		Timeout: 1 * time.Second,
+
+		MaxLimit: 100,
 	}
 
 	repo, err := postgres.New(cfgDB)
 	s.Require().NoError(err)
 
-	localcache, err := cache.New(repo)
+	localcache, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       5 * time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
 	s.Require().NoError(err)
+	s.repo = repo
+	s.cfgDB = cfgDB
+
+	var listenCtx context.Context
+	listenCtx, s.stopListen = context.WithCancel(context.Background())
+	m := metrics.New(&config.Metrics{Path: "/metrics", Namespace: "banner"})
+	m.RegisterPool(repo.DB.Stat)
+	localcache.Metrics = m
+	localcache.Notifier = repo
+
+	repo.Subscribe(localcache.Evict)
+	repo.SubscribePurge(localcache.EvictMatching)
+	go func() {
+		_ = repo.Listen(listenCtx)
+	}()
+
 	logger := slog.New(
 		slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}),
 	)
 
-	s.server = httptest.NewServer(server.New(cfgServer, repo, localcache, logger).Router)
+	s.privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&s.privateKey.PublicKey)
+	s.Require().NoError(err)
+	publicKeyPath := s.T().TempDir() + "/public.pem"
+	err = os.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}), 0o600)
+	s.Require().NoError(err)
+
+	verifier, err := auth.New(&config.Auth{
+		Secret:    authSecret,
+		PublicKey: publicKeyPath,
+		Issuer:    authIssuer,
+		Audience:  authAudience,
+	})
+	s.Require().NoError(err)
+	s.userToken = s.token(jwt.SigningMethodHS256, access.RoleUser, time.Now().Add(time.Hour))
+	s.adminToken = s.token(jwt.SigningMethodHS256, access.RoleAdmin, time.Now().Add(time.Hour))
+
+	s.runner = jobs.New(&config.Jobs{
+		BatchSize:    2,
+		Pause:        10 * time.Millisecond,
+		PollInterval: 100 * time.Millisecond,
+		Lease:        time.Minute,
+	}, repo, logger)
+	s.runner.Start()
+
+	// flushed explicitly by the tests
+	s.recorder = stats.New(&config.Stats{
+		BatchSize:     1000,
+		FlushInterval: time.Hour,
+	}, repo, logger)
+	s.recorder.Start()
+
+	s.server = httptest.NewServer(server.New(cfgServer, repo, localcache, s.runner, s.recorder, verifier, m, logger).Router)
 
 	db, err := sql.Open("postgres", s.psqlContainer.GetDSN())
 	s.Require().NoError(err)
@@ -87,11 +176,55 @@ func (s *TestSuite) TearDownSuite() {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer ctxCancel()
 
+	s.runner.Stop()
+	s.recorder.Stop()
+	s.stopListen()
 	s.Require().NoError(s.psqlContainer.Terminate(ctx))
 
 	s.server.Close()
 }
 
+func (s *TestSuite) token(method jwt.SigningMethod, role string, exp time.Time) string {
+	return s.tokenFor("test", method, role, exp)
+}
+
+func (s *TestSuite) tokenFor(subject string, method jwt.SigningMethod, role string, exp time.Time) string {
+	claims := auth.Claims{
+		Role: role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    authIssuer,
+			Audience:  jwt.ClaimStrings{authAudience},
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+	return s.sign(method, claims)
+}
+
+func (s *TestSuite) tenantToken(tenantID, role string) string {
+	claims := auth.Claims{
+		Role:   role,
+		Tenant: tenantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "test",
+			Issuer:    authIssuer,
+			Audience:  jwt.ClaimStrings{authAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	return s.sign(jwt.SigningMethodHS256, claims)
+}
+
+func (s *TestSuite) sign(method jwt.SigningMethod, claims auth.Claims) string {
+	var key interface{} = []byte(authSecret)
+	if method == jwt.SigningMethodRS256 {
+		key = s.privateKey
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	s.Require().NoError(err)
+	return token
+}
+
 func TestSuite_Run(t *testing.T) {
 	suite.Run(t, new(TestSuite))
 }
@@ -99,7 +232,7 @@ func TestSuite_Run(t *testing.T) {
 func (s *TestSuite) TestGetUserBanner() {
 
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?tag_id=1&feature_id=1")
 	req := &http.Request{
@@ -143,7 +276,7 @@ func (s *TestSuite) TestGetUserBannerpNotAuth() {
 
 func (s *TestSuite) TestGetUserBannerpNotAccess() {
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?tag_id=4&feature_id=2")
 	req := &http.Request{
@@ -162,7 +295,7 @@ func (s *TestSuite) TestGetUserBannerpNotAccess() {
 
 func (s *TestSuite) TestGetUserBannerNotFound1() {
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?tag_id=6&feature_id=1")
 	req := &http.Request{
@@ -181,7 +314,7 @@ func (s *TestSuite) TestGetUserBannerNotFound1() {
 
 func (s *TestSuite) TestGetUserBannerNotFound2() {
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?tag_id=5&feature_id=3")
 	req := &http.Request{
@@ -200,7 +333,7 @@ func (s *TestSuite) TestGetUserBannerNotFound2() {
 
 func (s *TestSuite) TestGetUserBannerBadQuerry1() {
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?tag_id=5")
 	req := &http.Request{
@@ -219,7 +352,7 @@ func (s *TestSuite) TestGetUserBannerBadQuerry1() {
 
 func (s *TestSuite) TestGetUserBannerBadQuerry2() {
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/user_banner?feature_id=1")
 	req := &http.Request{
@@ -238,7 +371,7 @@ func (s *TestSuite) TestGetUserBannerBadQuerry2() {
 
 func (s *TestSuite) TestGetBanner() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner?feature_id=2&tag_id=2")
 	req := &http.Request{
@@ -263,7 +396,7 @@ func (s *TestSuite) TestGetBanner() {
 
 func (s *TestSuite) TestGetBannerFeature() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner?feature_id=2")
 	req := &http.Request{
@@ -294,7 +427,7 @@ func (s *TestSuite) TestGetBannerFeature() {
 
 func (s *TestSuite) TestGetBannerTag() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner?tag_id=1")
 	req := &http.Request{
@@ -324,7 +457,7 @@ func (s *TestSuite) TestGetBannerTag() {
 
 func (s *TestSuite) TestGetBannerLimit() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner?tag_id=1&limit=1")
 	req := &http.Request{
@@ -348,7 +481,7 @@ func (s *TestSuite) TestGetBannerLimit() {
 }
 func (s *TestSuite) TestGetBannerOffset() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner?tag_id=1&offset=1")
 	req := &http.Request{
@@ -373,7 +506,7 @@ func (s *TestSuite) TestGetBannerOffset() {
 
 func (s *TestSuite) TestPostBanner() {
 	requestBody := `{
-		"tag_ids": [5], 
+		"tag_ids": [6], 
 		"feature_id": 1, 
 		"content": {
 			"color": "yellow", 
@@ -382,7 +515,7 @@ func (s *TestSuite) TestPostBanner() {
 		"is_active": true
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -452,7 +585,7 @@ func (s *TestSuite) TestPostBannerNotAccess() {
 		"is_active" :true
 		}`
 	header := http.Header{
-		"token": []string{"user_token"},
+		"token": []string{s.userToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -486,7 +619,7 @@ func (s *TestSuite) TestPostBannerBadRequest1() {
 		"is_active": true
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -521,7 +654,7 @@ func (s *TestSuite) TestPostBannerBadRequest2() {
 		"is_active": true
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -556,7 +689,7 @@ func (s *TestSuite) TestPostBannerBadRequest3() {
 		"is_active": true
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -591,7 +724,7 @@ func (s *TestSuite) TestPatchBanner() {
 		"is_active": false
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/1")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -626,7 +759,7 @@ func (s *TestSuite) TestPatchBannerNotFound() {
 		"is_active": false
 		}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/100")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -654,7 +787,7 @@ func (s *TestSuite) TestPatchBannerNullable() {
 		"is_active": null
 	}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/2")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -682,7 +815,7 @@ func (s *TestSuite) TestPatchBannerBadRequest1() {
 		"is_active": false
 	}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/2")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -718,7 +851,7 @@ func (s *TestSuite) TestPatchBannerBadRequest2() {
 		"is_active": false
 	}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/2")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -754,7 +887,7 @@ func (s *TestSuite) TestPatchBannerBadRequest3() {
 		"is_active": false
 	}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/2")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -789,7 +922,7 @@ func (s *TestSuite) TestPatchBannerBadRequest4() {
 		"is_active": false
 	}`
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/2")
 	reader := io.NopCloser(strings.NewReader(requestBody))
@@ -815,7 +948,7 @@ func (s *TestSuite) TestPatchBannerBadRequest4() {
 
 func (s *TestSuite) TestDeleteBanner() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/4")
 	req := &http.Request{
@@ -839,7 +972,7 @@ func (s *TestSuite) TestDeleteBanner() {
 
 func (s *TestSuite) TestDeleteBannerBadRequest1() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/a")
 	req := &http.Request{
@@ -863,7 +996,7 @@ func (s *TestSuite) TestDeleteBannerBadRequest1() {
 
 func (s *TestSuite) TestDeleteBannerBadRequest2() {
 	header := http.Header{
-		"token": []string{"admin_token"},
+		"token": []string{s.adminToken},
 	}
 	u, _ := url.Parse(s.server.URL + "/banner/5")
 	req := &http.Request{
@@ -879,3 +1012,1475 @@ func (s *TestSuite) TestDeleteBannerBadRequest2() {
 
 	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
 }
+
+func (s *TestSuite) do(method, path, token, body string) *http.Response {
+	header := http.Header{
+		"token": []string{token},
+	}
+	u, _ := url.Parse(s.server.URL + path)
+	req := &http.Request{
+		Method: method,
+		Header: header,
+		URL:    u,
+		Body:   io.NopCloser(strings.NewReader(body)),
+	}
+
+	res, err := s.server.Client().Do(req)
+	s.Require().NoError(err)
+	return res
+}
+
+func (s *TestSuite) TestVersionRestore() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [2],
+		"feature_id": 3,
+		"content": {"title": "v1"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	for _, title := range []string{"v2", "v3"} {
+		res := s.do("PATCH", "/banner/"+id, s.adminToken, `{"content": {"title": "`+title+`"}}`)
+		res.Body.Close()
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+	}
+
+	res = s.do("GET", "/banner/"+id+"/versions", s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var versions []models.BannerVersion
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&versions))
+	s.Require().Len(versions, 2)
+	s.Assert().Equal(int64(2), versions[0].Version)
+	s.Assert().Equal("v2", (*versions[0].Content)["title"])
+	s.Assert().Equal(int64(1), versions[1].Version)
+	s.Assert().Equal("v1", (*versions[1].Content)["title"])
+	s.Assert().NotNil(versions[1].Updated)
+
+	res = s.do("POST", "/banner/"+id+"/versions/1/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=2&feature_id=3&use_last_revision=true", s.userToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var banner map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banner))
+	s.Assert().Equal("v1", banner["title"])
+
+	res = s.do("GET", "/banner/"+id+"/versions", s.adminToken, "")
+	defer res.Body.Close()
+
+	versions = nil
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&versions))
+	s.Require().Len(versions, 3)
+	s.Assert().Equal("v3", (*versions[0].Content)["title"])
+}
+
+func (s *TestSuite) TestVersionRestoreLimit() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [3],
+		"feature_id": 3,
+		"content": {"title": "v1"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	for _, title := range []string{"v2", "v3", "v4", "v5"} {
+		res := s.do("PATCH", "/banner/"+id, s.adminToken, `{"content": {"title": "`+title+`"}}`)
+		res.Body.Close()
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+	}
+
+	res = s.do("GET", "/banner/"+id+"/versions", s.adminToken, "")
+	defer res.Body.Close()
+
+	var versions []models.BannerVersion
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&versions))
+	s.Require().Len(versions, 3)
+	s.Assert().Equal(int64(4), versions[0].Version)
+	s.Assert().Equal(int64(2), versions[2].Version)
+
+	res = s.do("POST", "/banner/"+id+"/versions/1/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("POST", "/banner/100/versions/1/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("POST", "/banner/"+id+"/versions/1/restore", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func (s *TestSuite) TestAuthRS256() {
+	token := s.token(jwt.SigningMethodRS256, access.RoleUser, time.Now().Add(time.Hour))
+
+	res := s.do("GET", "/user_banner?tag_id=1&feature_id=2", token, "")
+	defer res.Body.Close()
+
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *TestSuite) TestAuthExpired() {
+	token := s.token(jwt.SigningMethodHS256, access.RoleAdmin, time.Now().Add(-time.Hour))
+
+	res := s.do("GET", "/banner", token, "")
+	defer res.Body.Close()
+
+	s.Assert().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *TestSuite) TestAuthWrongSecret() {
+	claims := auth.Claims{
+		Role: access.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    authIssuer,
+			Audience:  jwt.ClaimStrings{authAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("wrong_secret"))
+	s.Require().NoError(err)
+
+	res := s.do("GET", "/banner", token, "")
+	defer res.Body.Close()
+
+	s.Assert().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *TestSuite) TestScheduleNotStarted() {
+	from := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [4],
+		"feature_id": 3,
+		"content": {"title": "later"},
+		"is_active": true,
+		"active_from": "`+from+`"
+		}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=4&feature_id=3", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=4&feature_id=3", s.adminToken, "")
+	defer res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	at := url.QueryEscape(time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339))
+	res = s.do("GET", "/banner?feature_id=3&tag_id=4&active_at="+at, s.adminToken, "")
+	defer res.Body.Close()
+
+	var banners []models.BannerDB
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+	s.Require().Len(banners, 1)
+	s.Assert().NotNil(banners[0].ActiveFrom)
+
+	at = url.QueryEscape(time.Now().UTC().Format(time.RFC3339))
+	res = s.do("GET", "/banner?feature_id=3&tag_id=4&active_at="+at, s.adminToken, "")
+	defer res.Body.Close()
+
+	banners = nil
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+	s.Assert().Empty(banners)
+}
+
+func (s *TestSuite) TestScheduleExpiredInCache() {
+	until := time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339Nano)
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [5],
+		"feature_id": 3,
+		"content": {"title": "soon gone"},
+		"is_active": true,
+		"active_until": "`+until+`"
+		}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=5&feature_id=3", s.userToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	time.Sleep(3 * time.Second)
+
+	res = s.do("GET", "/user_banner?tag_id=5&feature_id=3", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func (s *TestSuite) TestScheduleBadWindow() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [6],
+		"feature_id": 3,
+		"content": {"title": "never"},
+		"is_active": true,
+		"active_from": "2024-05-01T00:00:00Z",
+		"active_until": "2024-04-01T00:00:00Z"
+		}`)
+	defer res.Body.Close()
+
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func (s *TestSuite) TestSchedulePatchWindow() {
+	ids := make([]string, 0, 2)
+	for _, path := range []string{"/feature", "/tag"} {
+		res := s.do("POST", path, s.adminToken, `{"name": "window"}`)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		res.Body.Close()
+		ids = append(ids, strconv.Itoa(int(created["id"].(float64))))
+	}
+
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [`+ids[1]+`],
+		"feature_id": `+ids[0]+`,
+		"content": {"title": "window"},
+		"is_active": true,
+		"active_from": "2024-05-01T00:00:00Z"
+		}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	// only active_until is sent, the stored active_from is checked by the database
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"active_until": "2024-04-01T00:00:00Z"}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"active_until": "2024-06-01T00:00:00Z"}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *TestSuite) TestBannerConflict() {
+	conflicts := func(res *http.Response) []int64 {
+		defer res.Body.Close()
+		s.Require().Equal(http.StatusConflict, res.StatusCode)
+
+		var body struct {
+			Error     string                  `json:"error"`
+			Conflicts []models.BannerConflict `json:"conflicts"`
+		}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&body))
+		s.Assert().NotEmpty(body.Error)
+		ids := make([]int64, 0, len(body.Conflicts))
+		for _, conflict := range body.Conflicts {
+			ids = append(ids, conflict.BannerID)
+		}
+		return ids
+	}
+
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [3],
+		"feature_id": 1,
+		"content": {"title": "twin"},
+		"is_active": true
+		}`)
+	s.Assert().Equal([]int64{1}, conflicts(res))
+
+	res = s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [1, 4],
+		"feature_id": 2,
+		"content": {"title": "twin"},
+		"is_active": true
+		}`)
+	s.Assert().Equal([]int64{2, 3}, conflicts(res))
+
+	res = s.do("PATCH", "/banner/4", s.adminToken, `{"feature_id": 2, "tag_ids": [5]}`)
+	s.Assert().Equal([]int64{2}, conflicts(res))
+
+	res = s.do("PATCH", "/banner/4", s.adminToken, `{"feature_id": 1, "tag_ids": [2]}`)
+	s.Assert().Equal([]int64{1}, conflicts(res))
+
+	res = s.do("GET", "/user_banner?tag_id=6&feature_id=3&use_last_revision=true", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *TestSuite) TestBannerConcurrentCreate() {
+	const writers = 8
+
+	statuses := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := s.server.Client().Do(&http.Request{
+				Method: "POST",
+				Header: http.Header{"token": []string{s.adminToken}},
+				URL: &url.URL{Scheme: "http", Host: s.server.Listener.Addr().String(), Path: "/banner",
+					RawQuery: "create_missing=true"},
+				Body: io.NopCloser(strings.NewReader(`{
+					"tag_ids": [910001],
+					"feature_id": 910001,
+					"content": {"title": "race"},
+					"is_active": true
+					}`)),
+			})
+			if err != nil {
+				statuses <- 0
+				return
+			}
+			res.Body.Close()
+			statuses <- res.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	// one writer wins the pair, the others get a conflict and none an error
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	s.Assert().Equal(map[int]int{http.StatusCreated: 1, http.StatusConflict: writers - 1}, counts)
+}
+
+func (s *TestSuite) TestBulkDelete() {
+	for _, tag := range []string{"7", "8", "9"} {
+		res := s.do("POST", "/banner", s.adminToken, `{
+			"tag_ids": [`+tag+`],
+			"feature_id": 4,
+			"content": {"title": "retired"},
+			"is_active": true
+			}`)
+		res.Body.Close()
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+	}
+
+	res := s.do("DELETE", "/banner?feature_id=4", s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusAccepted, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["job_id"].(float64)))
+
+	var job models.Job
+	s.Require().Eventually(func() bool {
+		res, err := s.server.Client().Do(&http.Request{
+			Method: "GET",
+			Header: http.Header{"token": []string{s.adminToken}},
+			URL:    &url.URL{Scheme: "http", Host: s.server.Listener.Addr().String(), Path: "/jobs/" + id},
+		})
+		if err != nil {
+			return false
+		}
+		defer res.Body.Close()
+		return json.NewDecoder(res.Body).Decode(&job) == nil && job.Status == models.JobDone
+	}, 5*time.Second, 100*time.Millisecond)
+	s.Assert().Equal(int64(3), job.Total)
+	s.Assert().Equal(int64(3), job.Deleted)
+
+	res = s.do("GET", "/banner?feature_id=4", s.adminToken, "")
+	defer res.Body.Close()
+
+	var banners []models.BannerDB
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+	s.Assert().Empty(banners)
+}
+
+func (s *TestSuite) TestJobClaim() {
+	ctx := context.Background()
+	feature := int64(999999)
+	id, err := s.repo.CreateDeleteJob(ctx, &feature, nil)
+	s.Require().NoError(err)
+
+	claims := make(chan *models.Job, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(claims); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job, err := s.repo.NextJob(ctx, time.Minute)
+			if err == nil {
+				claims <- job
+			}
+		}()
+	}
+	wg.Wait()
+	close(claims)
+
+	var ours []*models.Job
+	for job := range claims {
+		if job.ID != id {
+			s.Require().NoError(s.repo.ReleaseJob(ctx, job))
+			continue
+		}
+		ours = append(ours, job)
+	}
+	s.Require().LessOrEqual(len(ours), 1)
+	if len(ours) == 0 {
+		// the suite runner claimed the job first
+		return
+	}
+
+	stale := *ours[0]
+	stale.Claim--
+	_, err = s.repo.DeleteBannersBatch(ctx, &stale, 10, time.Minute)
+	s.Assert().ErrorIs(err, storage.ErrJobClaimed)
+	s.Assert().ErrorIs(s.repo.FinishJob(ctx, &stale, nil), storage.ErrJobClaimed)
+
+	s.Require().NoError(s.repo.FinishJob(ctx, ours[0], nil))
+}
+
+func (s *TestSuite) TestBulkDeleteBadRequest() {
+	res := s.do("DELETE", "/banner", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("DELETE", "/banner?tag_id=a", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("GET", "/jobs/100", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *TestSuite) TestPatchBannerQuotedContent() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [7],
+		"feature_id": 5,
+		"content": {"title": "it's ' OR '1'='1"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"content": {"title": "'); DROP TABLE banner; --"}}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=7&feature_id=5&use_last_revision=true", s.userToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var banner map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banner))
+	s.Assert().Equal("'); DROP TABLE banner; --", banner["title"])
+}
+
+func (s *TestSuite) TestAdversarialIDs() {
+	for _, path := range []string{"/banner/1%20OR%201=1", "/banner/-1", "/banner/1;"} {
+		res := s.do("DELETE", path, s.adminToken, "")
+		res.Body.Close()
+		s.Assert().Equal(http.StatusBadRequest, res.StatusCode, path)
+
+		res = s.do("PATCH", path, s.adminToken, `{"is_active": false}`)
+		res.Body.Close()
+		s.Assert().Equal(http.StatusBadRequest, res.StatusCode, path)
+	}
+
+	res := s.do("DELETE", "/banner/99999999999", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("PATCH", "/banner/99999999999", s.adminToken, `{"is_active": false}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	for _, query := range []string{"tag_id=1%20OR%201=1", "feature_id=1)", "limit=-1", "offset=1;"} {
+		res := s.do("GET", "/banner?"+query, s.adminToken, "")
+		res.Body.Close()
+		s.Assert().Equal(http.StatusBadRequest, res.StatusCode, query)
+	}
+}
+
+func (s *TestSuite) TestGetBannerCursor() {
+	for _, tag := range []string{"7", "8", "9"} {
+		res := s.do("POST", "/banner", s.adminToken, `{
+			"tag_ids": [`+tag+`],
+			"feature_id": 6,
+			"content": {"title": "page"},
+			"is_active": true
+			}`)
+		res.Body.Close()
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+	}
+
+	res := s.do("GET", "/banner?feature_id=6&limit=2&cursor=", s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var page banner.Page
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&page))
+	s.Require().Len(page.Banners, 2)
+	s.Require().NotEmpty(page.NextCursor)
+	s.Assert().Less(*page.Banners[0].ID, *page.Banners[1].ID)
+	last := *page.Banners[1].ID
+
+	res = s.do("GET", "/banner?feature_id=6&limit=2&cursor="+page.NextCursor, s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	page = banner.Page{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&page))
+	s.Require().Len(page.Banners, 1)
+	s.Assert().Greater(*page.Banners[0].ID, last)
+	s.Assert().Empty(page.NextCursor)
+
+	res = s.do("GET", "/banner?feature_id=6&cursor=garbage", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("GET", "/banner?feature_id=6&cursor=&offset=1", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func (s *TestSuite) TestInvalidateOnPatch() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [10],
+		"feature_id": 5,
+		"content": {"title": "old"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	res = s.do("GET", "/user_banner?tag_id=10&feature_id=5", s.userToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"tag_ids": [11], "content": {"title": "new"}}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=10&feature_id=5", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=11&feature_id=5", s.userToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var banner map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banner))
+	s.Assert().Equal("new", banner["title"])
+
+	res = s.do("DELETE", "/banner/"+id, s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=11&feature_id=5", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *TestSuite) TestInvalidateOtherReplica() {
+	replica, err := postgres.New(s.cfgDB)
+	s.Require().NoError(err)
+	defer replica.DB.Close()
+
+	replicaCache, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       5 * time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, replica)
+	s.Require().NoError(err)
+
+	evicted := make(chan [][2]int, 1)
+	replica.Subscribe(replicaCache.Evict)
+	replica.Subscribe(func(_ string, keys [][2]int) {
+		select {
+		case evicted <- keys:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = replica.Listen(ctx)
+	}()
+
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [12],
+		"feature_id": 5,
+		"content": {"title": "old"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	banner, err := replicaCache.GetUserBanner(context.Background(), 12, 5, false, false)
+	s.Require().NoError(err)
+	s.Require().Equal("old", banner.Content["title"])
+
+	// the listener may still be connecting, so keep patching until it hears about a change
+	s.Require().Eventually(func() bool {
+		res, err := s.server.Client().Do(&http.Request{
+			Method: "PATCH",
+			Header: http.Header{"token": []string{s.adminToken}},
+			URL:    &url.URL{Scheme: "http", Host: s.server.Listener.Addr().String(), Path: "/banner/" + id},
+			Body:   io.NopCloser(strings.NewReader(`{"content": {"title": "new"}}`)),
+		})
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		select {
+		case keys := <-evicted:
+			return len(keys) == 1 && keys[0] == [2]int{12, 5}
+		case <-time.After(200 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 100*time.Millisecond)
+
+	banner, err = replicaCache.GetUserBanner(context.Background(), 12, 5, false, false)
+	s.Require().NoError(err)
+	s.Assert().Equal("new", banner.Content["title"])
+}
+
+func (s *TestSuite) TestPurgeOtherReplica() {
+	replica, err := postgres.New(s.cfgDB)
+	s.Require().NoError(err)
+	defer replica.DB.Close()
+
+	replicaCache, err := cache.New(&config.Cache{
+		Backend:     cache.BackendMemory,
+		TTL:         5 * time.Minute,
+		NegativeTTL: 5 * time.Minute,
+		KeyFormat:   "banner:%d:%d",
+	}, replica)
+	s.Require().NoError(err)
+
+	purged := make(chan *int, 1)
+	replica.SubscribePurge(replicaCache.EvictMatching)
+	replica.SubscribePurge(func(_ string, tag, _ *int) {
+		select {
+		case purged <- tag:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = replica.Listen(ctx)
+	}()
+
+	res := s.do("POST", "/banner?create_missing=true", s.adminToken, `{
+		"tag_ids": [920001],
+		"feature_id": 920001,
+		"content": {"title": "cached"},
+		"is_active": true
+		}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	// only the replica caches these keys, a "not found" among them
+	_, err = replicaCache.GetUserBanner(context.Background(), 920001, 920001, false, false)
+	s.Require().NoError(err)
+	_, err = replicaCache.GetUserBanner(context.Background(), 920001, 920002, false, false)
+	s.Require().ErrorIs(err, storage.ErrBannerNotFound)
+	_, err = replicaCache.GetUserBanner(context.Background(), 920002, 920001, false, false)
+	s.Require().ErrorIs(err, storage.ErrBannerNotFound)
+
+	// the listener may still be connecting, so keep purging until it hears about it
+	s.Require().Eventually(func() bool {
+		res := s.do("DELETE", "/admin/cache?tag_id=920001", s.adminToken, "")
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return false
+		}
+		select {
+		case tag := <-purged:
+			return tag != nil && *tag == 920001
+		case <-time.After(200 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 100*time.Millisecond)
+
+	stats, err := replicaCache.Inspect(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Equal(1, stats.Size)
+	s.Assert().Equal(920002, stats.Keys[0].Tag)
+}
+
+func (s *TestSuite) TestVariants() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [10],
+		"feature_id": 6,
+		"content": {"title": "base"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	res = s.do("GET", "/user_banner?tag_id=10&feature_id=6", s.userToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Equal(id, res.Header.Get("X-Banner-Id"))
+	s.Assert().Empty(res.Header.Get("X-Banner-Variant-Id"))
+
+	variants := map[string]string{}
+	for _, title := range []string{"a", "b"} {
+		res := s.do("POST", "/banner/"+id+"/variants", s.adminToken, `{"content": {"title": "`+title+`"}, "weight": 1}`)
+		defer res.Body.Close()
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		variants[strconv.Itoa(int(created["variant_id"].(float64)))] = title
+	}
+
+	served := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		token := s.tokenFor("user-"+strconv.Itoa(i), jwt.SigningMethodHS256, access.RoleUser, time.Now().Add(time.Hour))
+		var variant string
+		for j := 0; j < 2; j++ {
+			res := s.do("GET", "/user_banner?tag_id=10&feature_id=6", token, "")
+			defer res.Body.Close()
+			s.Require().Equal(http.StatusOK, res.StatusCode)
+
+			var banner map[string]interface{}
+			s.Require().NoError(json.NewDecoder(res.Body).Decode(&banner))
+			if j > 0 {
+				s.Assert().Equal(variant, res.Header.Get("X-Banner-Variant-Id"))
+			}
+			variant = res.Header.Get("X-Banner-Variant-Id")
+			s.Require().Contains(variants, variant)
+			s.Assert().Equal(variants[variant], banner["title"])
+		}
+		served[variant] = true
+	}
+	s.Assert().Len(served, 2)
+
+	res = s.do("GET", "/banner/"+id+"/variants", s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var list []models.Variant
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&list))
+	s.Require().Len(list, 2)
+
+	first := strconv.FormatInt(list[0].ID, 10)
+	res = s.do("PATCH", "/banner/"+id+"/variants/"+first, s.adminToken, `{"weight": 0}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("DELETE", "/banner/"+id+"/variants/"+first, s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	second := strconv.FormatInt(list[1].ID, 10)
+	res = s.do("GET", "/user_banner?tag_id=10&feature_id=6", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(second, res.Header.Get("X-Banner-Variant-Id"))
+
+	res = s.do("DELETE", "/banner/"+id+"/variants/"+first, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("POST", "/banner/"+id+"/variants", s.userToken, `{"content": {"title": "c"}, "weight": 1}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func (s *TestSuite) TestStats() {
+	res := s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [11],
+		"feature_id": 6,
+		"content": {"title": "stats"},
+		"is_active": true
+		}`)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	id := int64(created["banner_id"].(float64))
+	path := "/banner/" + strconv.FormatInt(id, 10) + "/stats"
+
+	// the second request is served from the cache and counted as well
+	for i := 0; i < 4; i++ {
+		res := s.do("GET", "/user_banner?tag_id=11&feature_id=6", s.userToken, "")
+		res.Body.Close()
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+	}
+	res = s.do("POST", "/user_banner/click", s.userToken, `{"banner_id": `+strconv.FormatInt(id, 10)+`}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("POST", "/user_banner/click", s.userToken, `{}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	s.Require().NoError(s.recorder.Flush(context.Background()))
+
+	res = s.do("GET", path, s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var stats []models.BannerStats
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&stats))
+	s.Require().Len(stats, 1)
+	s.Assert().Equal(time.Now().UTC().Format(time.DateOnly), stats[0].Day)
+	s.Assert().Equal(int64(4), stats[0].Impressions)
+	s.Assert().Equal(int64(1), stats[0].Clicks)
+	s.Assert().InDelta(0.25, stats[0].CTR, 1e-9)
+
+	res = s.do("GET", path+"?to=2000-01-01", s.adminToken, "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	stats = nil
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&stats))
+	s.Assert().Empty(stats)
+
+	res = s.do("GET", path+"?from=yesterday", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("GET", path, s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+
+	res = s.do("GET", "/banner/100000/stats", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *TestSuite) TestHealth() {
+	res := s.do("GET", "/healthz", "", "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/readyz", "", "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/banner", "", "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *TestSuite) TestMetrics() {
+	for i := 0; i < 2; i++ {
+		res := s.do("GET", "/user_banner?tag_id=1&feature_id=1", s.userToken, "")
+		res.Body.Close()
+	}
+
+	res := s.do("GET", "/metrics", "", "")
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	body, err := io.ReadAll(res.Body)
+	s.Require().NoError(err)
+	for _, metric := range []string{
+		`banner_http_requests_total{method="GET",route="/user_banner",status=`,
+		`banner_http_request_duration_seconds_bucket{method="GET",route="/user_banner"`,
+		"banner_cache_hits_total ",
+		"banner_cache_misses_total ",
+		"banner_cache_evictions_total ",
+		"banner_db_pool_acquired_conns ",
+		"banner_db_pool_acquire_wait_seconds_total ",
+	} {
+		s.Assert().Contains(string(body), metric)
+	}
+}
+
+func (s *TestSuite) TestQueryTimeout() {
+	cfg := *s.cfgDB
+	cfg.QueryTimeout = time.Nanosecond
+	repo, err := postgres.New(&cfg)
+	s.Require().NoError(err)
+	defer repo.Close()
+
+	_, err = repo.GetBanner(context.Background(), &models.BannerFilter{})
+	s.Require().ErrorIs(err, context.DeadlineExceeded)
+	s.Assert().Equal(http.StatusServiceUnavailable, resp.ContextStatus(err))
+}
+
+func (s *TestSuite) TestTenantIsolation() {
+	adminToken := s.tenantToken("tenant-b", access.RoleAdmin)
+	userToken := s.tenantToken("tenant-b", access.RoleUser)
+
+	res := s.do("GET", "/banner", adminToken, "")
+	var banners map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().Empty(banners["banners"])
+
+	res = s.do("GET", "/banner/1/versions", adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("DELETE", "/banner/1", adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", "/user_banner?tag_id=1&feature_id=2", userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("POST", "/banner", adminToken, `{
+		"tag_ids": [12],
+		"feature_id": 6,
+		"content": {"title": "foreign"},
+		"is_active": true
+		}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+
+	res = s.do("GET", "/banner", s.tenantToken("bad tenant", access.RoleAdmin), "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusUnauthorized, res.StatusCode)
+}
+
+func (s *TestSuite) TestRowLevelSecurity() {
+	ctx := context.Background()
+	other := tenant.With(ctx, "tenant-rls")
+
+	var bypass bool
+	err := s.repo.DB.QueryRow(ctx,
+		`SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user;`).Scan(&bypass)
+	s.Require().NoError(err)
+	s.Require().False(bypass)
+
+	// create_missing moves the sequences past the ids it inserts
+	for _, sequence := range []string{"feature_id_seq", "tag_id_seq"} {
+		var update bool
+		err = s.repo.DB.QueryRow(ctx, `SELECT has_sequence_privilege($1, 'UPDATE');`, sequence).Scan(&update)
+		s.Require().NoError(err)
+		s.Assert().True(update, sequence)
+	}
+
+	var id int64
+	err = s.repo.DB.QueryRow(other,
+		`INSERT INTO feature (name, tenant_id) VALUES ('rls', 'tenant-rls') RETURNING id;`).Scan(&id)
+	s.Require().NoError(err)
+	defer func() {
+		_, err := s.repo.DB.Exec(other, `DELETE FROM feature WHERE id = $1;`, id)
+		s.Require().NoError(err)
+	}()
+
+	// no tenant_id filter, the policies alone hide the rows of the other tenant
+	ids := func(ctx context.Context) []int64 {
+		rows, err := s.repo.DB.Query(ctx, `SELECT id FROM feature;`)
+		s.Require().NoError(err)
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		s.Require().NoError(err)
+		return ids
+	}
+	s.Assert().NotContains(ids(ctx), id)
+	s.Assert().NotEmpty(ids(ctx))
+	s.Assert().Equal([]int64{id}, ids(other))
+
+	var foreign int
+	for _, table := range []string{"tag", "banner"} {
+		err = s.repo.DB.QueryRow(other, `SELECT count(*) FROM `+table+`;`).Scan(&foreign)
+		s.Require().NoError(err)
+		s.Assert().Zero(foreign, table)
+	}
+
+	_, err = s.repo.DB.Exec(ctx, `INSERT INTO feature (name, tenant_id) VALUES ('rls', 'tenant-rls');`)
+	s.Require().Error(err)
+
+	res, err := s.repo.DB.Exec(ctx, `DELETE FROM feature WHERE id = $1;`, id)
+	s.Require().NoError(err)
+	s.Assert().Zero(res.RowsAffected())
+}
+
+func (s *TestSuite) TestChildRowLevelSecurity() {
+	ctx := context.Background()
+	other := tenant.With(ctx, "tenant-child")
+
+	var feature, tag, banner int64
+	err := s.repo.DB.QueryRow(other,
+		`INSERT INTO feature (name, tenant_id) VALUES ('child', 'tenant-child') RETURNING id;`).Scan(&feature)
+	s.Require().NoError(err)
+	err = s.repo.DB.QueryRow(other,
+		`INSERT INTO tag (name, tenant_id) VALUES ('child', 'tenant-child') RETURNING id;`).Scan(&tag)
+	s.Require().NoError(err)
+	err = s.repo.DB.QueryRow(other,
+		`INSERT INTO banner (feature, content, access, tenant_id)
+		VALUES ($1, '{}', true, 'tenant-child') RETURNING id;`, feature).Scan(&banner)
+	s.Require().NoError(err)
+	defer func() {
+		_, err := s.repo.DB.Exec(other, `DELETE FROM banner WHERE id = $1;`, banner)
+		s.Require().NoError(err)
+		_, err = s.repo.DB.Exec(other, `DELETE FROM tag WHERE id = $1;`, tag)
+		s.Require().NoError(err)
+		_, err = s.repo.DB.Exec(other, `DELETE FROM feature WHERE id = $1;`, feature)
+		s.Require().NoError(err)
+	}()
+
+	// the trigger takes tenant_id from the banner, none of the inserts sets it
+	for _, query := range []string{
+		`INSERT INTO bannertag (bannerid, tagid) VALUES ($1, $2);`,
+		`INSERT INTO bannervariant (bannerid, content, weight) VALUES ($1, '{}', 1);`,
+		`INSERT INTO bannerversion (bannerid, version, content) VALUES ($1, 1, '{}');`,
+		`INSERT INTO bannerstats (bannerid, day, impressions) VALUES ($1, CURRENT_DATE, 1);`,
+	} {
+		args := []interface{}{banner}
+		if strings.Contains(query, "bannertag") {
+			args = append(args, tag)
+		}
+		_, err = s.repo.DB.Exec(other, query, args...)
+		s.Require().NoError(err, query)
+	}
+	_, err = s.repo.DB.Exec(other, `UPDATE banner SET deleted_at = NOW() WHERE id = $1;`, banner)
+	s.Require().NoError(err)
+
+	// read directly, without a join through banner
+	for _, table := range []string{"bannertag", "bannervariant", "bannerversion", "bannerstats", "bannertrash"} {
+		var n int
+		err = s.repo.DB.QueryRow(ctx, `SELECT count(*) FROM `+table+` WHERE bannerid = $1;`, banner).Scan(&n)
+		s.Require().NoError(err)
+		s.Assert().Zero(n, table)
+
+		err = s.repo.DB.QueryRow(other, `SELECT count(*) FROM `+table+` WHERE bannerid = $1;`, banner).Scan(&n)
+		s.Require().NoError(err)
+		s.Assert().Equal(1, n, table)
+	}
+
+	// a row of a foreign banner gets no tenant
+	_, err = s.repo.DB.Exec(ctx, `INSERT INTO bannervariant (bannerid, content, weight) VALUES ($1, '{}', 1);`, banner)
+	s.Require().Error(err)
+
+	// the purger still finds the trash of every tenant
+	tenants, err := s.repo.TrashTenants(ctx, time.Now().Add(time.Minute))
+	s.Require().NoError(err)
+	s.Assert().Contains(tenants, "tenant-child")
+}
+
+func (s *TestSuite) TestReferences() {
+	decode := func(res *http.Response, dst interface{}) {
+		defer res.Body.Close()
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(dst))
+	}
+
+	res := s.do("GET", "/feature", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+
+	res = s.do("POST", "/feature", s.adminToken, `{"name": "checkout", "description": "checkout page"}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	var created map[string]interface{}
+	decode(res, &created)
+	feature := strconv.Itoa(int(created["id"].(float64)))
+
+	res = s.do("PATCH", "/feature/"+feature, s.adminToken, `{"name": "cart"}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("PATCH", "/feature/"+feature, s.adminToken, `{"name": null}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("GET", "/feature/"+feature, s.adminToken, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	var got models.Reference
+	decode(res, &got)
+	s.Assert().Equal("cart", got.Name)
+	s.Assert().Equal("checkout page", got.Description)
+
+	res = s.do("POST", "/tag", s.adminToken, `{"name": "vip"}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	decode(res, &created)
+	tag := strconv.Itoa(int(created["id"].(float64)))
+
+	res = s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [`+tag+`],
+		"feature_id": `+feature+`,
+		"content": {"title": "named"},
+		"is_active": true
+		}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	res = s.do("DELETE", "/feature/"+feature, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusConflict, res.StatusCode)
+
+	res = s.do("DELETE", "/tag/"+tag, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusConflict, res.StatusCode)
+
+	body := `{
+		"tag_ids": [900002],
+		"feature_id": 900001,
+		"content": {"title": "auto"},
+		"is_active": true
+		}`
+	res = s.do("POST", "/banner", s.adminToken, body)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+
+	res = s.do("POST", "/banner?create_missing=true", s.adminToken, body)
+	res.Body.Close()
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+
+	res = s.do("GET", "/tag/900002", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("POST", "/tag", s.adminToken, `{"name": "unused"}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	decode(res, &created)
+	s.Assert().Greater(created["id"].(float64), float64(900002))
+	unused := strconv.Itoa(int(created["id"].(float64)))
+
+	res = s.do("DELETE", "/tag/"+unused, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("GET", "/tag/"+unused, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", "/tag?limit=2", s.adminToken, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	var tags []models.Reference
+	decode(res, &tags)
+	s.Assert().Len(tags, 2)
+}
+
+func (s *TestSuite) TestVersionRestoreDeletedReference() {
+	created := func(res *http.Response) string {
+		defer res.Body.Close()
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var body map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&body))
+		if id, ok := body["banner_id"]; ok {
+			return strconv.Itoa(int(id.(float64)))
+		}
+		return strconv.Itoa(int(body["id"].(float64)))
+	}
+
+	feature := created(s.do("POST", "/feature", s.adminToken, `{"name": "retired"}`))
+	tag := created(s.do("POST", "/tag", s.adminToken, `{"name": "retired"}`))
+	id := created(s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [`+tag+`],
+		"feature_id": `+feature+`,
+		"content": {"title": "v1"},
+		"is_active": true
+		}`))
+
+	res := s.do("PATCH", "/banner/"+id, s.adminToken, `{"feature_id": 1}`)
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	// no current banner uses the feature anymore, only version 1 does
+	res = s.do("DELETE", "/feature/"+feature, s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("POST", "/banner/"+id+"/versions/1/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusUnprocessableEntity, res.StatusCode)
+}
+
+func (s *TestSuite) TestUserBannerBatch() {
+	ids := make([]int64, 0, 2)
+	for _, banner := range []string{
+		`{"tag_ids": [3], "feature_id": 2, "content": {"title": "slot"}, "is_active": true}`,
+		`{"tag_ids": [6], "feature_id": 2, "content": {"title": "hidden"}, "is_active": false}`,
+	} {
+		res := s.do("POST", "/banner", s.adminToken, banner)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		res.Body.Close()
+		ids = append(ids, int64(created["banner_id"].(float64)))
+	}
+
+	res := s.do("POST", "/user_banner/batch", s.userToken, `[
+		{"tag_id": 3, "feature_id": 2},
+		{"tag_id": 6, "feature_id": 2},
+		{"tag_id": 999, "feature_id": 2},
+		{"tag_id": 3, "feature_id": 2}
+		]`)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	var items map[string]userbanner.BatchItem
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&items))
+	res.Body.Close()
+
+	s.Require().Len(items, 3)
+	s.Assert().Equal(userbanner.StatusFound, items["3:2"].Status)
+	s.Assert().Equal(ids[0], items["3:2"].BannerID)
+	s.Assert().Equal("slot", items["3:2"].Content["title"])
+	s.Assert().Equal(userbanner.StatusInactive, items["6:2"].Status)
+	s.Assert().Nil(items["6:2"].Content)
+	s.Assert().Equal(userbanner.StatusNotFound, items["999:2"].Status)
+
+	res = s.do("POST", "/user_banner/batch", s.adminToken, `[{"tag_id": 6, "feature_id": 2}]`)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&items))
+	res.Body.Close()
+	s.Assert().Equal(ids[1], items["6:2"].BannerID)
+
+	for _, body := range []string{`[]`, `[{"tag_id": 0, "feature_id": 2}]`, `{"tag_id": 3}`} {
+		res = s.do("POST", "/user_banner/batch", s.userToken, body)
+		res.Body.Close()
+		s.Assert().Equal(http.StatusBadRequest, res.StatusCode, body)
+	}
+}
+
+func (s *TestSuite) TestFeatureSchema() {
+	ids := make([]string, 0, 2)
+	for _, path := range []string{"/feature", "/tag"} {
+		res := s.do("POST", path, s.adminToken, `{"name": "promo"}`)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		res.Body.Close()
+		ids = append(ids, strconv.Itoa(int(created["id"].(float64))))
+	}
+	feature, tag := ids[0], ids[1]
+
+	res := s.do("GET", "/feature/"+feature+"/schema", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("PUT", "/feature/"+feature+"/schema", s.adminToken, `{"type": "nope"}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res = s.do("PUT", "/feature/"+feature+"/schema", s.adminToken, bannerSchema)
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [`+tag+`],
+		"feature_id": `+feature+`,
+		"content": {"title": "", "url": "not a url"},
+		"is_active": true
+		}`)
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+	var invalid resp.Response
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&invalid))
+	res.Body.Close()
+	s.Require().Len(invalid.Violations, 2)
+	s.Assert().Equal("/title", invalid.Violations[0].Pointer)
+	s.Assert().Equal("/url", invalid.Violations[1].Pointer)
+
+	res = s.do("POST", "/banner", s.adminToken, `{
+		"tag_ids": [`+tag+`],
+		"feature_id": `+feature+`,
+		"content": {"title": "sale", "url": "https://example.com/sale"},
+		"is_active": true
+		}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	var created map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	id := strconv.Itoa(int(created["banner_id"].(float64)))
+
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"content": {"title": "sale"}}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusBadRequest, res.StatusCode)
+
+	// users are served variant content, it must match the schema too
+	res = s.do("POST", "/banner/"+id+"/variants", s.adminToken, `{"content": {"title": "b", "url": "nope"}, "weight": 1}`)
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+	invalid = resp.Response{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&invalid))
+	res.Body.Close()
+	s.Require().Len(invalid.Violations, 1)
+	s.Assert().Equal("/url", invalid.Violations[0].Pointer)
+
+	res = s.do("POST", "/banner/"+id+"/variants", s.adminToken, `{"content": {"title": "b", "url": "https://example.com/b"}, "weight": 1}`)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+	res.Body.Close()
+	variant := strconv.Itoa(int(created["variant_id"].(float64)))
+
+	res = s.do("PATCH", "/banner/"+id+"/variants/"+variant, s.adminToken, `{"content": {"url": "https://example.com/b"}}`)
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+	invalid = resp.Response{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&invalid))
+	res.Body.Close()
+	s.Require().Len(invalid.Violations, 1)
+	s.Assert().Contains(invalid.Violations[0].Message, "title")
+
+	res = s.do("PATCH", "/banner/"+id+"/variants/"+variant, s.adminToken, `{"weight": 3}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+
+	res = s.do("GET", "/feature/"+feature+"/schema", s.adminToken, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	var stored map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&stored))
+	res.Body.Close()
+	s.Assert().Equal("object", stored["type"])
+
+	res = s.do("DELETE", "/feature/"+feature+"/schema", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("PATCH", "/banner/"+id, s.adminToken, `{"content": {"title": "sale"}}`)
+	res.Body.Close()
+	s.Assert().Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *TestSuite) TestTrash() {
+	ids := make([]string, 0, 2)
+	for _, path := range []string{"/feature", "/tag"} {
+		res := s.do("POST", path, s.adminToken, `{"name": "trash"}`)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		res.Body.Close()
+		ids = append(ids, strconv.Itoa(int(created["id"].(float64))))
+	}
+	feature, tag := ids[0], ids[1]
+
+	post := func(title string) string {
+		res := s.do("POST", "/banner", s.adminToken, `{
+			"tag_ids": [`+tag+`],
+			"feature_id": `+feature+`,
+			"content": {"title": "`+title+`"},
+			"is_active": true
+			}`)
+		s.Require().Equal(http.StatusCreated, res.StatusCode)
+		var created map[string]interface{}
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&created))
+		res.Body.Close()
+		return strconv.Itoa(int(created["banner_id"].(float64)))
+	}
+	trashed := func() []int64 {
+		res := s.do("GET", "/banner/trash", s.adminToken, "")
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+		var banners []models.BannerDB
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+		res.Body.Close()
+		ids := make([]int64, 0, len(banners))
+		for _, banner := range banners {
+			s.Assert().NotNil(banner.Deleted)
+			ids = append(ids, *banner.ID)
+		}
+		return ids
+	}
+	userBanner := "/user_banner?tag_id=" + tag + "&feature_id=" + feature + "&use_last_revision=true"
+
+	first := post("first")
+	firstID, _ := strconv.ParseInt(first, 10, 64)
+
+	res := s.do("DELETE", "/banner/"+first, s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("DELETE", "/banner/"+first, s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", userBanner, s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", "/banner?feature_id="+feature, s.adminToken, "")
+	var banners []models.BannerDB
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&banners))
+	res.Body.Close()
+	s.Assert().Empty(banners)
+	s.Assert().Contains(trashed(), firstID)
+
+	res = s.do("GET", "/banner/trash", s.userToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusForbidden, res.StatusCode)
+
+	// the trashed banner gives up its pair
+	second := post("second")
+
+	res = s.do("POST", "/banner/"+first+"/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusConflict, res.StatusCode)
+
+	res = s.do("DELETE", "/banner/"+second, s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusNoContent, res.StatusCode)
+
+	res = s.do("POST", "/banner/"+first+"/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Assert().NotContains(trashed(), firstID)
+
+	res = s.do("POST", "/banner/"+first+"/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+
+	res = s.do("GET", userBanner, s.userToken, "")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	var content map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&content))
+	res.Body.Close()
+	s.Assert().Equal("first", content["title"])
+
+	secondID, _ := strconv.ParseInt(second, 10, 64)
+	_, err := s.repo.DB.Exec(context.Background(),
+		`UPDATE banner SET deleted_at = NOW() - INTERVAL '60 days' WHERE id = $1;`, secondID)
+	s.Require().NoError(err)
+
+	purger := trash.New(&config.Trash{Retention: 30 * 24 * time.Hour, BatchSize: 10}, s.repo,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	purged, err := purger.Purge(context.Background())
+	s.Require().NoError(err)
+	s.Assert().Equal(int64(1), purged)
+	s.Assert().NotContains(trashed(), secondID)
+
+	res = s.do("POST", "/banner/"+second+"/restore", s.adminToken, "")
+	res.Body.Close()
+	s.Assert().Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *TestSuite) TestWarmupSnapshot() {
+	ctx := context.Background()
+	since := time.Now().Add(-7 * 24 * time.Hour)
+
+	snapshot, err := s.repo.GetUserBannerSnapshot(ctx, since, 0)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(snapshot)
+	for _, banner := range snapshot {
+		s.Assert().True(*banner.Banner.Access)
+		// banner 4 was trashed by TestDeleteBanner
+		s.Assert().NotEqual(int64(4), banner.Banner.ID)
+	}
+
+	limited, err := s.repo.GetUserBannerSnapshot(ctx, since, 1)
+	s.Require().NoError(err)
+	s.Assert().Len(limited, 1)
+
+	other, err := s.repo.GetUserBannerSnapshot(tenant.With(ctx, "other"), since, 0)
+	s.Require().NoError(err)
+	s.Assert().Empty(other)
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	userbanner "github.com/AnxVit/avito/internal/http-server/handlers/user_banner"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserBannerBatchDefaultLimit(t *testing.T) {
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, newCountingRepo())
+	require.NoError(t, err)
+	handler := userbanner.NewBatch(slog.New(slog.NewTextHandler(io.Discard, nil)), c, nopTracker{}, 0)
+
+	do := func(n int) *httptest.ResponseRecorder {
+		items := make([]string, 0, n)
+		for i := 1; i <= n; i++ {
+			items = append(items, fmt.Sprintf(`{"tag_id": %d, "feature_id": 1}`, i))
+		}
+		ctx := context.WithValue(context.Background(), auth.UserContextKey, access.Principal{Subject: "test", Access: access.User})
+		rec := httptest.NewRecorder()
+		body := strings.NewReader("[" + strings.Join(items, ",") + "]")
+		handler(rec, httptest.NewRequest("POST", "/user_banner/batch", body).WithContext(ctx))
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, do(1).Code)
+	require.Equal(t, http.StatusOK, do(userbanner.DefaultMaxBatch).Code)
+
+	rec := do(userbanner.DefaultMaxBatch + 1)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), fmt.Sprintf("from 1 to %d items", userbanner.DefaultMaxBatch))
+
+	rec = do(0)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
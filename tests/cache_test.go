@@ -0,0 +1,485 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingRepo struct {
+	calls   atomic.Int64
+	banner  models.UserBanner
+	missing atomic.Bool
+
+	mu      sync.Mutex
+	batches [][][2]int
+
+	snapshots   atomic.Int64
+	snapshotErr error
+	// onSnapshot runs while the snapshot query is in flight
+	onSnapshot func()
+}
+
+func (r *countingRepo) GetUserBanner(_ context.Context, _, _ int, admin bool) (*models.UserBanner, error) {
+	r.calls.Add(1)
+	if r.missing.Load() {
+		return nil, storage.ErrBannerNotFound
+	}
+	if !r.banner.Visible(admin, time.Now()) {
+		return nil, storage.ErrNotAccess
+	}
+	banner := r.banner
+	return &banner, nil
+}
+
+// GetUserBanners has a banner for tag 1 only.
+func (r *countingRepo) GetUserBanners(_ context.Context, keys [][2]int) (map[[2]int]*models.UserBanner, error) {
+	r.mu.Lock()
+	r.batches = append(r.batches, keys)
+	r.mu.Unlock()
+	banners := make(map[[2]int]*models.UserBanner)
+	for _, key := range keys {
+		if key[0] == 1 {
+			banner := r.banner
+			banners[key] = &banner
+		}
+	}
+	return banners, nil
+}
+
+// GetUserBannerSnapshot has the banner under {1, 1} and the less shown {2, 1}.
+func (r *countingRepo) GetUserBannerSnapshot(ctx context.Context, _ time.Time, limit int) ([]models.KeyedBanner, error) {
+	r.snapshots.Add(1)
+	if r.onSnapshot != nil {
+		r.onSnapshot()
+	}
+	if r.snapshotErr != nil {
+		return nil, r.snapshotErr
+	}
+	snapshot := make([]models.KeyedBanner, 0, 2)
+	for i, key := range []models.BannerKey{{Tag: 1, Feature: 1}, {Tag: 2, Feature: 1}} {
+		banner := r.banner
+		banner.Content = map[string]interface{}{"title": tenant.FromContext(ctx) + ":" + strconv.Itoa(key.Tag)}
+		banner.ID = int64(i + 1)
+		snapshot = append(snapshot, models.KeyedBanner{Key: key, Banner: &banner})
+	}
+	if limit > 0 && limit < len(snapshot) {
+		snapshot = snapshot[:limit]
+	}
+	return snapshot, nil
+}
+
+func newCountingRepo() *countingRepo {
+	active := true
+	return &countingRepo{
+		banner: models.UserBanner{
+			Content: map[string]interface{}{
+				"title": "sky",
+				"tags":  []interface{}{"blue", 1.0},
+				"nested": map[string]interface{}{
+					"empty": nil,
+				},
+			},
+			Access: &active,
+		},
+	}
+}
+
+func TestCacheMemoryStore(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		banner, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+		require.NoError(t, err)
+		require.Equal(t, "sky", banner.Content["title"])
+	}
+	require.Equal(t, int64(1), repo.calls.Load())
+
+	_, err = c.GetUserBanner(context.Background(), 1, 2, true, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), repo.calls.Load())
+}
+
+func TestCacheBatch(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	banners, err := c.GetUserBanners(ctx, [][2]int{{1, 2}, {3, 4}}, false)
+	require.NoError(t, err)
+	require.Len(t, banners, 1)
+	require.Equal(t, "sky", banners[[2]int{1, 2}].Content["title"])
+	require.Equal(t, [][][2]int{{{1, 2}, {3, 4}}}, repo.batches)
+
+	banners, err = c.GetUserBanners(ctx, [][2]int{{1, 2}, {3, 4}}, false)
+	require.NoError(t, err)
+	require.Len(t, banners, 1)
+	require.Equal(t, [][2]int{{3, 4}}, repo.batches[1])
+
+	_, err = c.GetUserBanner(ctx, 1, 2, false, false)
+	require.NoError(t, err)
+	require.Zero(t, repo.calls.Load())
+
+	_, err = c.GetUserBanners(ctx, [][2]int{{1, 2}}, true)
+	require.NoError(t, err)
+	require.Len(t, repo.batches, 3)
+}
+
+// gatedRepo holds every GetUserBanner call until the gate is closed.
+type gatedRepo struct {
+	*countingRepo
+	gate    chan struct{}
+	waiting atomic.Int64
+}
+
+func (r *gatedRepo) GetUserBanner(ctx context.Context, tag, feature int, admin bool) (*models.UserBanner, error) {
+	r.waiting.Add(1)
+	<-r.gate
+	return r.countingRepo.GetUserBanner(ctx, tag, feature, admin)
+}
+
+func newGatedRepo() *gatedRepo {
+	return &gatedRepo{countingRepo: newCountingRepo(), gate: make(chan struct{})}
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	repo := newGatedRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+
+	const callers = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			banner, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+			if err == nil && banner.Content["title"] != "sky" {
+				err = errors.New("unexpected banner")
+			}
+			errs <- err
+		}()
+	}
+
+	require.Eventually(t, func() bool { return repo.waiting.Load() == 1 }, time.Second, time.Millisecond)
+	close(repo.gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(1), repo.calls.Load())
+
+	// other keys and tenants are fetched on their own
+	_, err = c.GetUserBanner(context.Background(), 1, 3, false, false)
+	require.NoError(t, err)
+	_, err = c.GetUserBanner(tenant.With(context.Background(), "acme"), 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), repo.calls.Load())
+}
+
+func TestCacheSingleFlightCanceled(t *testing.T) {
+	repo := newGatedRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := c.GetUserBanner(ctx, 1, 2, false, false)
+		leader <- err
+	}()
+	require.Eventually(t, func() bool { return repo.waiting.Load() == 1 }, time.Second, time.Millisecond)
+
+	follower := make(chan error, 1)
+	go func() {
+		_, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+		follower <- err
+	}()
+
+	cancel()
+	require.ErrorIs(t, <-leader, context.Canceled)
+
+	close(repo.gate)
+	require.NoError(t, <-follower)
+	require.Equal(t, int64(1), repo.calls.Load())
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	repo := newGatedRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       20 * time.Millisecond,
+		StaleTTL:  time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// the first fetch goes through, the refresh is held
+	refresh := make(chan struct{})
+	close(repo.gate)
+	_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), repo.calls.Load())
+	repo.gate = refresh
+
+	time.Sleep(40 * time.Millisecond)
+
+	// the expired entry is served at once while a single refresh is running
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			banner, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+			assert.NoError(t, err)
+			assert.Equal(t, "sky", banner.Content["title"])
+		}()
+	}
+	wg.Wait()
+	require.Eventually(t, func() bool { return repo.waiting.Load() == 2 }, time.Second, time.Millisecond)
+
+	close(repo.gate)
+	require.Eventually(t, func() bool { return repo.calls.Load() == 2 }, time.Second, time.Millisecond)
+
+	// the refreshed entry is fresh again
+	require.Eventually(t, func() bool {
+		_, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+		return err == nil && repo.waiting.Load() == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, int64(2), repo.calls.Load())
+}
+
+func TestCacheStaleDisabled(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       20 * time.Millisecond,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.NoError(t, err)
+	time.Sleep(40 * time.Millisecond)
+	_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), repo.calls.Load())
+}
+
+func TestCacheEvictDuringFetch(t *testing.T) {
+	repo := newGatedRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return repo.waiting.Load() == 1 }, time.Second, time.Millisecond)
+
+	// a write lands while the old banner is being read
+	c.Evict(tenant.Default, [][2]int{{1, 2}})
+	close(repo.gate)
+	require.NoError(t, <-done)
+
+	_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), repo.calls.Load())
+}
+
+func TestCacheInactiveShared(t *testing.T) {
+	repo := newCountingRepo()
+	inactive := false
+	repo.banner.Access = &inactive
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+
+	_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.ErrorIs(t, err, storage.ErrNotAccess)
+	banner, err := c.GetUserBanner(context.Background(), 1, 2, false, true)
+	require.NoError(t, err)
+	require.Equal(t, "sky", banner.Content["title"])
+	require.Equal(t, int64(1), repo.calls.Load())
+}
+
+func TestCacheNegative(t *testing.T) {
+	repo := newCountingRepo()
+	repo.missing.Store(true)
+	c, err := cache.New(&config.Cache{
+		Backend:     cache.BackendMemory,
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		KeyFormat:   "banner:%d:%d",
+	}, repo)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err = c.GetUserBanner(ctx, 1, 2, false, false)
+		require.ErrorIs(t, err, storage.ErrBannerNotFound)
+		_, err = c.GetUserBanner(ctx, 1, 2, false, true)
+		require.ErrorIs(t, err, storage.ErrBannerNotFound)
+	}
+	require.Equal(t, int64(1), repo.calls.Load())
+
+	// creating a banner evicts its keys
+	repo.missing.Store(false)
+	c.Evict(tenant.Default, [][2]int{{1, 2}})
+	banner, err := c.GetUserBanner(ctx, 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, "sky", banner.Content["title"])
+	require.Equal(t, int64(2), repo.calls.Load())
+
+	// misses of the batch are remembered as well
+	banners, err := c.GetUserBanners(ctx, [][2]int{{3, 4}}, false)
+	require.NoError(t, err)
+	require.Empty(t, banners)
+	banners, err = c.GetUserBanners(ctx, [][2]int{{3, 4}}, false)
+	require.NoError(t, err)
+	require.Empty(t, banners)
+	require.Len(t, repo.batches, 1)
+
+	_, err = c.GetUserBanner(ctx, 4, 3, false, false)
+	require.NoError(t, err)
+	_, err = c.GetUserBanner(ctx, 3, 4, false, false)
+	require.ErrorIs(t, err, storage.ErrBannerNotFound)
+	require.Equal(t, int64(3), repo.calls.Load())
+}
+
+func TestCacheNegativeExpires(t *testing.T) {
+	for _, negativeTTL := range []time.Duration{0, 20 * time.Millisecond} {
+		repo := newCountingRepo()
+		repo.missing.Store(true)
+		c, err := cache.New(&config.Cache{
+			Backend:     cache.BackendMemory,
+			TTL:         time.Minute,
+			StaleTTL:    time.Minute,
+			NegativeTTL: negativeTTL,
+			KeyFormat:   "banner:%d:%d",
+		}, repo)
+		require.NoError(t, err)
+
+		_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+		require.ErrorIs(t, err, storage.ErrBannerNotFound)
+		time.Sleep(40 * time.Millisecond)
+		_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+		require.ErrorIs(t, err, storage.ErrBannerNotFound)
+		require.Equal(t, int64(2), repo.calls.Load(), negativeTTL)
+	}
+}
+
+func TestCacheRedisStore(t *testing.T) {
+	for _, codec := range []string{cache.CodecJSON, cache.CodecGob} {
+		t.Run(codec, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			repo := newCountingRepo()
+			c, err := cache.New(&config.Cache{
+				Backend:     cache.BackendRedis,
+				TTL:         time.Minute,
+				KeyFormat:   "avito/banner/%d/%d",
+				Codec:       codec,
+				Redis:       config.Redis{Addr: server.Addr()},
+				NegativeTTL: time.Minute,
+			}, repo)
+			require.NoError(t, err)
+			defer c.Close()
+
+			first, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+			require.NoError(t, err)
+			require.True(t, server.Exists("default:avito/banner/1/2"))
+
+			second, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+			require.NoError(t, err)
+			require.Equal(t, first, second)
+			require.Equal(t, int64(1), repo.calls.Load())
+
+			server.FastForward(2 * time.Minute)
+			require.False(t, server.Exists("default:avito/banner/1/2"))
+
+			_, err = c.GetUserBanner(context.Background(), 1, 2, false, false)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), repo.calls.Load())
+
+			repo.missing.Store(true)
+			for i := 0; i < 2; i++ {
+				_, err = c.GetUserBanner(context.Background(), 1, 3, false, false)
+				require.ErrorIs(t, err, storage.ErrBannerNotFound)
+			}
+			require.Equal(t, int64(3), repo.calls.Load())
+		})
+	}
+}
+
+func TestCacheRedisUnavailable(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendRedis,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+		Codec:     cache.CodecJSON,
+		Redis:     config.Redis{Addr: "127.0.0.1:1"},
+	}, repo)
+	require.NoError(t, err)
+	defer c.Close()
+
+	banner, err := c.GetUserBanner(context.Background(), 1, 2, false, false)
+	require.NoError(t, err)
+	require.Equal(t, "sky", banner.Content["title"])
+}
+
+func TestCacheBadConfig(t *testing.T) {
+	_, err := cache.New(&config.Cache{Backend: cache.BackendMemory, KeyFormat: "banner"}, newCountingRepo())
+	require.Error(t, err)
+
+	_, err = cache.New(&config.Cache{Backend: "memcached", KeyFormat: "%d:%d"}, newCountingRepo())
+	require.Error(t, err)
+
+	_, err = cache.New(&config.Cache{Backend: cache.BackendRedis, KeyFormat: "%d:%d", Codec: "xml"}, newCountingRepo())
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AnxVit/avito/internal/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() config.Config {
+	return config.Config{
+		Server: config.Server{MaxBatch: 50},
+		Jobs:   config.Jobs{BatchSize: 100},
+		Trash:  config.Trash{BatchSize: 100},
+		Stats:  config.Stats{BatchSize: 1000, MaxPending: 100000},
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := validConfig()
+	require.NoError(t, cfg.Validate())
+
+	for name, tc := range map[string]struct {
+		change func(cfg *config.Config)
+		err    string
+	}{
+		"zero user banner batch": {
+			change: func(cfg *config.Config) { cfg.Server.MaxBatch = 0 },
+			err:    "httpServer.maxBatch",
+		},
+		"zero jobs batch": {
+			change: func(cfg *config.Config) { cfg.Jobs.BatchSize = 0 },
+			err:    "jobs.batchSize",
+		},
+		"zero trash batch": {
+			change: func(cfg *config.Config) { cfg.Trash.BatchSize = 0 },
+			err:    "trash.batchSize",
+		},
+		"negative trash batch": {
+			change: func(cfg *config.Config) { cfg.Trash.BatchSize = -1 },
+			err:    "trash.batchSize",
+		},
+		"zero stats batch": {
+			change: func(cfg *config.Config) { cfg.Stats.BatchSize = 0 },
+			err:    "stats.batchSize",
+		},
+		"stats pending below batch": {
+			change: func(cfg *config.Config) { cfg.Stats.MaxPending = 10 },
+			err:    "stats.maxPending",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.change(&cfg)
+			err := cfg.Validate()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -11,6 +11,13 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
+// AppUser and AppPassword are the defaults of the app role migration, the
+// service role that row level security applies to. GetDSN is the owner.
+const (
+	AppUser     = "banner_app"
+	AppPassword = "banner_app"
+)
+
 type PostgresContainer struct {
 	testcontainers.Container
 	Port string
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	userbanner "github.com/AnxVit/avito/internal/http-server/handlers/user_banner"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	resp "github.com/AnxVit/avito/internal/lib/api/response"
+
+	"github.com/stretchr/testify/require"
+)
+
+type blockingBanner struct{}
+
+func (blockingBanner) GetUserBanner(ctx context.Context, _, _ int, _, _ bool) (*models.UserBanner, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("storage.postgres.GetUserBanner: %w", ctx.Err())
+}
+
+type nopTracker struct{}
+
+func (nopTracker) Impression(context.Context, int64) {}
+func (nopTracker) Click(context.Context, int64)      {}
+
+func TestContextStatus(t *testing.T) {
+	require.Equal(t, resp.StatusClientClosedRequest, resp.ContextStatus(fmt.Errorf("op: %w", context.Canceled)))
+	require.Equal(t, http.StatusServiceUnavailable, resp.ContextStatus(fmt.Errorf("op: %w", context.DeadlineExceeded)))
+	require.Zero(t, resp.ContextStatus(io.EOF))
+}
+
+func TestUserBannerCanceled(t *testing.T) {
+	handler := userbanner.New(slog.New(slog.NewTextHandler(io.Discard, nil)), blockingBanner{}, nopTracker{})
+
+	for _, tc := range []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		status int
+	}{
+		{"client gone", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, resp.StatusClientClosedRequest},
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 0)
+		}, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			ctx = context.WithValue(ctx, auth.UserContextKey, access.Principal{Subject: "test", Access: access.User})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("GET", "/user_banner?tag_id=1&feature_id=1", nil).WithContext(ctx))
+			require.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
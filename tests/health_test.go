@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AnxVit/avito/internal/http-server/handlers/health"
+
+	"github.com/stretchr/testify/require"
+)
+
+type checker struct {
+	err error
+}
+
+func (c checker) Ready(context.Context) error {
+	return c.err
+}
+
+func TestReady(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	rec := httptest.NewRecorder()
+	health.NewReady(log, checker{})(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	health.NewReady(log, checker{err: errors.New("schema version 0")})(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
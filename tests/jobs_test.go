@@ -0,0 +1,164 @@
+package test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/jobs"
+	"github.com/AnxVit/avito/internal/storage"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lockedRepo has one job. Its locked banners are held by another transaction
+// until the third count, batches skip them like FOR UPDATE SKIP LOCKED does.
+type lockedRepo struct {
+	mu        sync.Mutex
+	job       models.Job
+	claimed   bool
+	claimLost bool
+	free      int64
+	locked    int64
+	counts    int
+	batches   int
+	released  int
+	finished  []error
+}
+
+func (r *lockedRepo) CreateDeleteJob(context.Context, *int64, *int64) (int64, error) {
+	return 0, nil
+}
+
+func (r *lockedRepo) GetJob(context.Context, int64) (*models.Job, error) {
+	return nil, storage.ErrJobNotFound
+}
+
+func (r *lockedRepo) NextJob(context.Context, time.Duration) (*models.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.claimed {
+		return nil, storage.ErrJobNotFound
+	}
+	r.claimed = true
+	job := r.job
+	return &job, nil
+}
+
+func (r *lockedRepo) DeleteBannersBatch(_ context.Context, job *models.Job, limit int, _ time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches++
+	if r.claimLost {
+		return 0, storage.ErrJobClaimed
+	}
+	n := min(r.free, int64(limit))
+	r.free -= n
+	r.job.Deleted += n
+	job.Deleted += n
+	return n, nil
+}
+
+func (r *lockedRepo) CountJobBanners(context.Context, *models.Job) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts++
+	if r.counts == 3 {
+		r.free += r.locked
+		r.locked = 0
+	}
+	return r.free + r.locked, nil
+}
+
+func (r *lockedRepo) ReleaseJob(context.Context, *models.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.released++
+	return nil
+}
+
+func (r *lockedRepo) FinishJob(_ context.Context, _ *models.Job, jobErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = append(r.finished, jobErr)
+	return nil
+}
+
+func (r *lockedRepo) state() (finished []error, deleted int64, counts, batches, released int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.finished...), r.job.Deleted, r.counts, r.batches, r.released
+}
+
+func newRunner(repo jobs.Repository, pause time.Duration) *jobs.Runner {
+	return jobs.New(&config.Jobs{
+		BatchSize:    2,
+		Pause:        pause,
+		PollInterval: 5 * time.Millisecond,
+		Lease:        time.Minute,
+	}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestRunnerWaitsForLockedBanners(t *testing.T) {
+	for _, pause := range []time.Duration{0, time.Millisecond} {
+		repo := &lockedRepo{job: models.Job{ID: 1, Total: 5}, free: 3, locked: 2}
+		runner := newRunner(repo, pause)
+		runner.Start()
+
+		require.Eventually(t, func() bool {
+			finished, _, _, _, _ := repo.state()
+			return len(finished) > 0
+		}, 2*time.Second, time.Millisecond)
+		runner.Stop()
+
+		finished, deleted, counts, _, _ := repo.state()
+		require.Equal(t, []error{nil}, finished)
+		require.Equal(t, int64(5), deleted)
+		// two counts see the locked banners, the third unlocks them, the last one sees none
+		require.Equal(t, 4, counts)
+	}
+}
+
+func TestRunnerClaimLost(t *testing.T) {
+	repo := &lockedRepo{job: models.Job{ID: 1, Total: 5}, free: 5, claimLost: true}
+	runner := newRunner(repo, time.Millisecond)
+	runner.Start()
+
+	require.Eventually(t, func() bool {
+		_, _, _, batches, _ := repo.state()
+		return batches > 0
+	}, 2*time.Second, time.Millisecond)
+	runner.Stop()
+
+	finished, deleted, _, batches, released := repo.state()
+	require.Empty(t, finished)
+	require.Zero(t, deleted)
+	require.Equal(t, 1, batches)
+	require.Zero(t, released)
+}
+
+func TestRunnerZeroBatch(t *testing.T) {
+	repo := &lockedRepo{job: models.Job{ID: 1, Total: 5}, free: 5}
+	runner := jobs.New(&config.Jobs{
+		PollInterval: 5 * time.Millisecond,
+		Lease:        time.Minute,
+	}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	runner.Start()
+
+	require.Eventually(t, func() bool {
+		finished, _, _, _, _ := repo.state()
+		return len(finished) > 0
+	}, 2*time.Second, time.Millisecond)
+	runner.Stop()
+
+	finished, deleted, _, batches, _ := repo.state()
+	require.Len(t, finished, 1)
+	require.Error(t, finished[0])
+	require.Zero(t, deleted)
+	require.Zero(t, batches)
+}
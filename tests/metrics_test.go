@@ -0,0 +1,42 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/metrics"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsRoutePattern(t *testing.T) {
+	m := metrics.New(&config.Metrics{Path: "/stats/prometheus", Namespace: "test"})
+
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Handle(m.Path, m.Handler())
+	router.Get("/banner/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, path := range []string{"/banner/1", "/banner/2", "/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	m.Hit()
+	m.Evict(3)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/stats/prometheus", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), `test_http_requests_total{method="GET",route="/banner/{id}",status="418"} 2`)
+	require.Contains(t, string(body), `test_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	require.Contains(t, string(body), "test_cache_hits_total 1")
+	require.Contains(t, string(body), "test_cache_evictions_total 3")
+}
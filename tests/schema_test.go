@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/schema"
+
+	"github.com/stretchr/testify/require"
+)
+
+const bannerSchema = `{
+	"type": "object",
+	"required": ["title", "url"],
+	"properties": {
+		"title": {"type": "string", "minLength": 1},
+		"url": {"type": "string", "format": "uri"}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	violations, err := schema.Validate([]byte(bannerSchema), map[string]interface{}{
+		"title": "sale",
+		"url":   "https://example.com/sale",
+	})
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	violations, err = schema.Validate([]byte(bannerSchema), map[string]interface{}{
+		"title": 1.0,
+		"url":   "not a url",
+	})
+	require.NoError(t, err)
+	require.Len(t, violations, 2)
+	require.Equal(t, "/title", violations[0].Pointer)
+	require.Equal(t, "/url", violations[1].Pointer)
+
+	violations, err = schema.Validate([]byte(bannerSchema), map[string]interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, []models.Violation{{Pointer: "", Message: violations[0].Message}}, violations)
+	require.Contains(t, violations[0].Message, "title")
+
+	violations, err = schema.Validate(nil, map[string]interface{}{})
+	require.NoError(t, err)
+	require.Empty(t, violations)
+}
+
+func TestSchemaCompile(t *testing.T) {
+	_, err := schema.Compile([]byte(`{"type": "nope"}`))
+	require.ErrorIs(t, err, schema.ErrInvalidSchema)
+
+	_, err = schema.Compile([]byte(`{"$ref": "file:///etc/passwd"}`))
+	require.ErrorIs(t, err, schema.ErrInvalidSchema)
+
+	_, err = schema.Compile([]byte(`{"$ref": "https://example.com/schema.json"}`))
+	require.ErrorIs(t, err, schema.ErrInvalidSchema)
+}
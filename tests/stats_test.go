@@ -0,0 +1,164 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/stats"
+
+	"github.com/stretchr/testify/require"
+)
+
+type statsRepo struct {
+	mu     sync.Mutex
+	fail   bool
+	saved  map[int64]models.StatsDelta
+	writes int
+}
+
+func (r *statsRepo) SaveStats(_ context.Context, deltas []models.StatsDelta) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return errors.New("unavailable")
+	}
+	r.writes++
+	for _, delta := range deltas {
+		saved := r.saved[delta.BannerID]
+		saved.Impressions += delta.Impressions
+		saved.Clicks += delta.Clicks
+		r.saved[delta.BannerID] = saved
+	}
+	return nil
+}
+
+func (r *statsRepo) get(id int64) models.StatsDelta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saved[id]
+}
+
+func TestStatsRecorderBatches(t *testing.T) {
+	repo := &statsRepo{saved: map[int64]models.StatsDelta{}}
+	recorder := stats.New(&config.Stats{BatchSize: 1000, FlushInterval: time.Hour}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recorder.Impression(ctx, 1)
+			}
+			recorder.Click(ctx, 1)
+			recorder.Impression(ctx, 2)
+		}()
+	}
+	wg.Wait()
+
+	require.Zero(t, repo.get(1).Impressions)
+	require.NoError(t, recorder.Flush(ctx))
+	require.Equal(t, 1, repo.writes)
+	require.Equal(t, int64(1000), repo.get(1).Impressions)
+	require.Equal(t, int64(10), repo.get(1).Clicks)
+	require.Equal(t, int64(10), repo.get(2).Impressions)
+}
+
+func TestStatsRecorderRetry(t *testing.T) {
+	repo := &statsRepo{saved: map[int64]models.StatsDelta{}, fail: true}
+	recorder := stats.New(&config.Stats{BatchSize: 1000, FlushInterval: time.Hour}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	recorder.Impression(ctx, 1)
+	require.Error(t, recorder.Flush(ctx))
+
+	repo.mu.Lock()
+	repo.fail = false
+	repo.mu.Unlock()
+	recorder.Impression(ctx, 1)
+	recorder.Start()
+	recorder.Stop()
+
+	require.Equal(t, int64(2), repo.get(1).Impressions)
+}
+
+func TestStatsRecorderPendingLimit(t *testing.T) {
+	repo := &statsRepo{saved: map[int64]models.StatsDelta{}, fail: true}
+	var logs bytes.Buffer
+	recorder := stats.New(&config.Stats{BatchSize: 1, MaxPending: 2, FlushInterval: time.Hour}, repo,
+		slog.New(slog.NewTextHandler(&logs, nil)))
+	ctx := context.Background()
+
+	recorder.Impression(ctx, 1)
+	recorder.Impression(ctx, 2)
+	// a third key does not fit, known keys still count
+	recorder.Impression(ctx, 3)
+	recorder.Click(ctx, 1)
+	require.Error(t, recorder.Flush(ctx))
+
+	repo.mu.Lock()
+	repo.fail = false
+	repo.mu.Unlock()
+	recorder.Start()
+	recorder.Stop()
+
+	require.Equal(t, int64(1), repo.get(1).Impressions)
+	require.Equal(t, int64(1), repo.get(1).Clicks)
+	require.Equal(t, int64(1), repo.get(2).Impressions)
+	require.Zero(t, repo.get(3).Impressions)
+	// one batch per key with BatchSize 1
+	require.Equal(t, 2, repo.writes)
+	require.Contains(t, logs.String(), "stats dropped")
+	require.Contains(t, logs.String(), "impressions=1")
+}
+
+func TestStatsRecorderFlushWhenFull(t *testing.T) {
+	repo := &statsRepo{saved: map[int64]models.StatsDelta{}}
+	recorder := stats.New(&config.Stats{BatchSize: 2, FlushInterval: time.Hour}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	recorder.Start()
+	defer recorder.Stop()
+
+	recorder.Impression(ctx, 1)
+	recorder.Impression(ctx, 2)
+
+	require.Eventually(t, func() bool {
+		return repo.get(2).Impressions == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+type tenantStatsRepo struct {
+	batches map[string][]models.StatsDelta
+}
+
+func (r *tenantStatsRepo) SaveStats(ctx context.Context, deltas []models.StatsDelta) error {
+	r.batches[tenant.FromContext(ctx)] = deltas
+	return nil
+}
+
+func TestStatsRecorderTenants(t *testing.T) {
+	repo := &tenantStatsRepo{batches: map[string][]models.StatsDelta{}}
+	recorder := stats.New(&config.Stats{BatchSize: 1000, FlushInterval: time.Hour}, repo, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	recorder.Impression(ctx, 1)
+	recorder.Impression(tenant.With(ctx, "acme"), 1)
+	recorder.Click(tenant.With(ctx, "acme"), 1)
+	require.NoError(t, recorder.Flush(ctx))
+
+	require.Len(t, repo.batches, 2)
+	require.Equal(t, []models.StatsDelta{{Tenant: tenant.Default, BannerID: 1, Day: repo.batches[tenant.Default][0].Day, Impressions: 1}}, repo.batches[tenant.Default])
+	require.Len(t, repo.batches["acme"], 1)
+	require.Equal(t, "acme", repo.batches["acme"][0].Tenant)
+	require.Equal(t, int64(1), repo.batches["acme"][0].Clicks)
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/domain/models"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func entry(title string) *cache.Entry {
+	return &cache.Entry{
+		Banner:     &models.UserBanner{Content: map[string]interface{}{"title": title}},
+		FreshUntil: time.Now().Add(time.Minute),
+	}
+}
+
+func TestMemoryStoreLRU(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStore(2)
+
+	require.NoError(t, store.Set(ctx, "a", entry("a"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", entry("b"), time.Minute))
+
+	// reading a makes b the least recently used
+	_, ok, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, store.Set(ctx, "c", entry("c"), time.Minute))
+	require.Equal(t, 2, store.Len())
+
+	_, ok, _ = store.Get(ctx, "b")
+	require.False(t, ok)
+	for _, key := range []string{"a", "c"} {
+		got, ok, _ := store.Get(ctx, key)
+		require.True(t, ok, key)
+		require.Equal(t, key, got.Banner.Content["title"])
+	}
+
+	// overwriting does not grow the store
+	require.NoError(t, store.Set(ctx, "a", entry("a2"), time.Minute))
+	require.Equal(t, 2, store.Len())
+	got, _, _ := store.Get(ctx, "a")
+	require.Equal(t, "a2", got.Banner.Content["title"])
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	_, ok, _ = store.Get(ctx, "a")
+	require.False(t, ok)
+	require.Equal(t, 1, store.Len())
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	ctx := context.Background()
+	store := cache.NewMemoryStore(10)
+
+	require.NoError(t, store.Set(ctx, "short", entry("short"), 10*time.Millisecond))
+	require.NoError(t, store.Set(ctx, "long", entry("long"), time.Minute))
+	time.Sleep(20 * time.Millisecond)
+
+	_, ok, _ := store.Get(ctx, "short")
+	require.False(t, ok)
+	_, ok, _ = store.Get(ctx, "long")
+	require.True(t, ok)
+	require.Equal(t, 1, store.Len())
+
+	// setting again renews the ttl
+	require.NoError(t, store.Set(ctx, "long", entry("long"), 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	_, ok, _ = store.Get(ctx, "long")
+	require.False(t, ok)
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	const maxEntries = 64
+	ctx := context.Background()
+	store := cache.NewMemoryStore(maxEntries)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				key := strconv.Itoa(rnd.Intn(256))
+				switch rnd.Intn(3) {
+				case 0:
+					_ = store.Set(ctx, key, entry(key), time.Duration(rnd.Intn(5))*time.Millisecond+time.Millisecond)
+				case 1:
+					if got, ok, _ := store.Get(ctx, key); ok && got.Banner.Content["title"] != key {
+						t.Errorf("key %s holds %v", key, got.Banner.Content["title"])
+					}
+				default:
+					_ = store.Delete(ctx, key)
+				}
+				if n := store.Len(); n > maxEntries {
+					t.Errorf("store holds %d entries", n)
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	require.LessOrEqual(t, store.Len(), maxEntries)
+}
+
+func TestCacheConcurrent(t *testing.T) {
+	repo := newCountingRepo()
+	c, err := cache.New(&config.Cache{
+		Backend:    cache.BackendMemory,
+		TTL:        5 * time.Millisecond,
+		StaleTTL:   5 * time.Millisecond,
+		KeyFormat:  "banner:%d:%d",
+		MaxEntries: 16,
+	}, repo)
+	require.NoError(t, err)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			ctx := context.Background()
+			if seed%2 == 0 {
+				ctx = tenant.With(ctx, "acme")
+			}
+			for i := 0; i < 500; i++ {
+				tag, feature := rnd.Intn(8)+1, rnd.Intn(8)+1
+				switch rnd.Intn(10) {
+				case 0:
+					c.Evict(tenant.FromContext(ctx), [][2]int{{tag, feature}})
+				case 1:
+					_, err := c.GetUserBanners(ctx, [][2]int{{tag, feature}, {1, feature}}, false)
+					if err != nil {
+						t.Error(err)
+					}
+				default:
+					banner, err := c.GetUserBanner(ctx, tag, feature, false, false)
+					if err != nil {
+						t.Error(err)
+					} else if banner.Content["title"] != "sky" {
+						t.Errorf("unexpected banner %v", banner.Content)
+					}
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth"
+	"github.com/AnxVit/avito/internal/http-server/middleware/auth/access"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantContext(t *testing.T) {
+	require.Equal(t, tenant.Default, tenant.FromContext(context.Background()))
+	require.Equal(t, "acme", tenant.FromContext(tenant.With(context.Background(), "acme")))
+
+	require.True(t, tenant.Valid("tenant_b-1"))
+	require.False(t, tenant.Valid(""))
+	require.False(t, tenant.Valid("a b"))
+	require.False(t, tenant.Valid("a:b"))
+}
+
+func TestVerifyTenantClaim(t *testing.T) {
+	verifier, err := auth.New(&config.Auth{Secret: authSecret})
+	require.NoError(t, err)
+
+	sign := func(tenantID string) string {
+		claims := auth.Claims{
+			Role:   access.RoleAdmin,
+			Tenant: tenantID,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(authSecret))
+		require.NoError(t, err)
+		return token
+	}
+
+	principal, err := verifier.Verify(sign(""))
+	require.NoError(t, err)
+	require.Equal(t, tenant.Default, principal.Tenant)
+
+	principal, err = verifier.Verify(sign("acme"))
+	require.NoError(t, err)
+	require.Equal(t, "acme", principal.Tenant)
+
+	_, err = verifier.Verify(sign("../acme"))
+	require.ErrorIs(t, err, auth.ErrInvalidTenant)
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/storage/cache"
+	"github.com/AnxVit/avito/internal/tracing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingSpans(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Tracing{Exporter: tracing.ExporterNone})
+	require.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	c, err := cache.New(&config.Cache{
+		Backend:   cache.BackendMemory,
+		TTL:       time.Minute,
+		KeyFormat: "banner:%d:%d",
+	}, newCountingRepo())
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Get("/user_banner/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, err := c.GetUserBanner(r.Context(), 1, 2, false, false)
+		require.NoError(t, err)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/user_banner/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	cacheSpan, serverSpan := spans[0], spans[1]
+	require.Equal(t, "cache.GetUserBanner", cacheSpan.Name())
+	require.Equal(t, "GET /user_banner/{id}", serverSpan.Name())
+	require.Equal(t, traceID, serverSpan.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+	require.Equal(t, serverSpan.SpanContext().SpanID(), cacheSpan.Parent().SpanID())
+}
+
+func TestTracingBadExporter(t *testing.T) {
+	_, err := tracing.Setup(context.Background(), &config.Tracing{Exporter: "zipkin"})
+	require.Error(t, err)
+}
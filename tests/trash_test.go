@@ -0,0 +1,113 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/trash"
+
+	"github.com/stretchr/testify/require"
+)
+
+type trashRepo struct {
+	mu      sync.Mutex
+	trashed map[string]int64
+	fail    string
+	before  time.Time
+	calls   map[string]int
+}
+
+func (r *trashRepo) TrashTenants(_ context.Context, before time.Time) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.before = before
+	tenants := make([]string, 0, len(r.trashed))
+	for t := range r.trashed {
+		tenants = append(tenants, t)
+	}
+	return tenants, nil
+}
+
+func (r *trashRepo) PurgeBanners(ctx context.Context, _ time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := tenant.FromContext(ctx)
+	r.calls[t]++
+	if t == r.fail {
+		return 0, errors.New("unavailable")
+	}
+	n := min(r.trashed[t], int64(limit))
+	r.trashed[t] -= n
+	return n, nil
+}
+
+func TestTrashPurgerBatches(t *testing.T) {
+	repo := &trashRepo{
+		trashed: map[string]int64{"default": 5, "acme": 4},
+		calls:   map[string]int{},
+	}
+	purger := trash.New(&config.Trash{Retention: time.Hour, Interval: time.Hour, BatchSize: 2}, repo,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	purged, err := purger.Purge(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(9), purged)
+	require.Equal(t, map[string]int64{"default": 0, "acme": 0}, repo.trashed)
+	require.Equal(t, 3, repo.calls["default"])
+	require.Equal(t, 3, repo.calls["acme"])
+	require.WithinDuration(t, time.Now().Add(-time.Hour), repo.before, time.Minute)
+}
+
+func TestTrashPurgerTenantFailure(t *testing.T) {
+	repo := &trashRepo{
+		trashed: map[string]int64{"default": 3, "acme": 3},
+		fail:    "acme",
+		calls:   map[string]int{},
+	}
+	purger := trash.New(&config.Trash{Retention: time.Hour, Interval: time.Hour, BatchSize: 10}, repo,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	purged, err := purger.Purge(context.Background())
+	require.Error(t, err)
+	require.Equal(t, int64(3), purged)
+	require.Equal(t, int64(0), repo.trashed["default"])
+	require.Equal(t, 1, repo.calls["acme"])
+}
+
+func TestTrashPurgerStop(t *testing.T) {
+	repo := &trashRepo{
+		trashed: map[string]int64{"default": 1},
+		calls:   map[string]int{},
+	}
+	purger := trash.New(&config.Trash{Retention: time.Hour, Interval: time.Hour, BatchSize: 10}, repo,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	purger.Start()
+	require.Eventually(t, func() bool {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return repo.trashed["default"] == 0
+	}, time.Second, 10*time.Millisecond)
+	purger.Stop()
+}
+
+func TestTrashPurgerZeroBatch(t *testing.T) {
+	repo := &trashRepo{
+		trashed: map[string]int64{"default": 3},
+		calls:   map[string]int{},
+	}
+	purger := trash.New(&config.Trash{Retention: time.Hour, Interval: time.Hour}, repo,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	purged, err := purger.Purge(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, purged)
+	require.Equal(t, 1, repo.calls["default"])
+}
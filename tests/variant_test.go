@@ -0,0 +1,42 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/AnxVit/avito/internal/domain/models"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVariantPick(t *testing.T) {
+	banner := models.UserBanner{
+		ID:      7,
+		Content: map[string]interface{}{"title": "base"},
+		Variants: []models.Variant{
+			{ID: 1, Weight: 1, Content: map[string]interface{}{"title": "a"}},
+			{ID: 2, Weight: 3, Content: map[string]interface{}{"title": "b"}},
+		},
+	}
+
+	served := map[int64]int{}
+	for i := 0; i < 4000; i++ {
+		user := "user-" + strconv.Itoa(i)
+		content, variant := banner.Pick(user)
+		again, same := banner.Pick(user)
+		require.Equal(t, variant, same)
+		require.Equal(t, content, again)
+		served[variant]++
+	}
+	require.Zero(t, served[0])
+	require.InDelta(t, 1000, served[1], 150)
+	require.InDelta(t, 3000, served[2], 150)
+}
+
+func TestVariantPickWithoutVariants(t *testing.T) {
+	banner := models.UserBanner{ID: 7, Content: map[string]interface{}{"title": "base"}}
+
+	content, variant := banner.Pick("user")
+	require.Equal(t, "base", content["title"])
+	require.Zero(t, variant)
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AnxVit/avito/internal/config"
+	"github.com/AnxVit/avito/internal/http-server/handlers/health"
+	"github.com/AnxVit/avito/internal/lib/tenant"
+	"github.com/AnxVit/avito/internal/storage/cache"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newWarmupCache(t *testing.T, repo *countingRepo, maxEntries int) *cache.Cache {
+	c, err := cache.New(&config.Cache{
+		Backend:    cache.BackendMemory,
+		TTL:        time.Minute,
+		KeyFormat:  "banner:%d:%d",
+		MaxEntries: maxEntries,
+	}, repo)
+	require.NoError(t, err)
+	return c
+}
+
+func TestCacheWarmup(t *testing.T) {
+	repo := newCountingRepo()
+	c := newWarmupCache(t, repo, 0)
+	require.NoError(t, c.Ready(context.Background()))
+
+	warmer := cache.NewWarmer(&config.Warmup{
+		Enabled: true,
+		Tenants: []string{tenant.Default, "acme"},
+		Timeout: time.Second,
+	}, c, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.ErrorIs(t, c.Ready(context.Background()), cache.ErrWarming)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rec := httptest.NewRecorder()
+	health.NewReady(log, checker{}, c)(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	require.NoError(t, warmer.Warm(context.Background()))
+	require.NoError(t, c.Ready(context.Background()))
+	require.Equal(t, int64(2), repo.snapshots.Load())
+
+	rec = httptest.NewRecorder()
+	health.NewReady(log, checker{}, c)(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	for _, tenantID := range []string{tenant.Default, "acme"} {
+		banner, err := c.GetUserBanner(tenant.With(context.Background(), tenantID), 1, 1, false, false)
+		require.NoError(t, err)
+		require.Equal(t, tenantID+":1", banner.Content["title"])
+	}
+	require.Zero(t, repo.calls.Load())
+}
+
+func TestCacheWarmupKeepsMostShown(t *testing.T) {
+	repo := newCountingRepo()
+	c := newWarmupCache(t, repo, 1)
+
+	n, err := c.Refresh(context.Background(), time.Now().Add(-time.Hour), 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	banner, err := c.GetUserBanner(context.Background(), 1, 1, false, false)
+	require.NoError(t, err)
+	require.Equal(t, "default:1", banner.Content["title"])
+	require.Zero(t, repo.calls.Load())
+}
+
+func TestCacheRefreshSkipsEvicted(t *testing.T) {
+	repo := newCountingRepo()
+	c := newWarmupCache(t, repo, 0)
+	// writes of other keys and tenants do not cost the snapshot
+	repo.onSnapshot = func() {
+		c.Evict(tenant.Default, [][2]int{{1, 1}, {3, 3}})
+		c.Evict("acme", [][2]int{{2, 1}})
+	}
+
+	n, err := c.Refresh(context.Background(), time.Now().Add(-time.Hour), 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	stats, err := c.Inspect(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Size)
+	require.Equal(t, [2]int{2, 1}, [2]int{stats.Keys[0].Tag, stats.Keys[0].Feature})
+
+	// a later refresh is not affected by the earlier evictions
+	repo.onSnapshot = nil
+	n, err = c.Refresh(context.Background(), time.Now().Add(-time.Hour), 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestCacheWarmupFailure(t *testing.T) {
+	repo := newCountingRepo()
+	repo.snapshotErr = errors.New("unavailable")
+	c := newWarmupCache(t, repo, 0)
+
+	warmer := cache.NewWarmer(&config.Warmup{Enabled: true, Tenants: []string{tenant.Default}}, c,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Error(t, warmer.Warm(context.Background()))
+
+	// the database still serves the banners
+	require.NoError(t, c.Ready(context.Background()))
+}
+
+func TestCacheWarmupRefresh(t *testing.T) {
+	repo := newCountingRepo()
+	c := newWarmupCache(t, repo, 0)
+
+	warmer := cache.NewWarmer(&config.Warmup{
+		Enabled:         true,
+		Tenants:         []string{tenant.Default},
+		RefreshInterval: 10 * time.Millisecond,
+	}, c, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	warmer.Start()
+	require.Eventually(t, func() bool { return repo.snapshots.Load() >= 3 }, time.Second, 5*time.Millisecond)
+	warmer.Stop()
+	require.NoError(t, c.Ready(context.Background()))
+
+	// disabled warm-up does not hold readiness
+	disabled := newWarmupCache(t, newCountingRepo(), 0)
+	cache.NewWarmer(&config.Warmup{}, disabled, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, disabled.Ready(context.Background()))
+}